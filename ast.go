@@ -5,14 +5,33 @@ import "fmt"
 const (
 	WHITESPACE = "\\s"
 	NONWHITESPACE = "\\S"
+	DIGIT = "\\d"
+	NONDIGIT = "\\D"
+	WORD = "\\w"
+	NONWORD = "\\W"
+	BEGIN_TEXT = "\\A"
+	END_TEXT = "\\z"
+	WORD_BOUNDARY = "\\b"
+	NON_WORD_BOUNDARY = "\\B"
+	// ANY_CHAR is the dot in (?s) mode, which also matches a newline
+	ANY_CHAR = "(?s:.)"
+	// BEGIN_LINE and END_LINE are ^ and $ in (?m) mode, which also match
+	// just after and just before a newline
+	BEGIN_LINE = "(?m:^)"
+	END_LINE = "(?m:$)"
 )
 
 type Node interface {
 	String() string
 }
 
+// StarNode and the other quantifiers are greedy unless Lazy is set, as it is
+// for *?, +?, ?? and {m,n}?, in which case they prefer fewer iterations.
+// Possessive ones, *+, ++, ?+ and {m,n}+, are greedy and atomic.
 type StarNode struct {
-	Child Node
+	Child      Node
+	Lazy       bool
+	Possessive bool
 }
 
 type SequenceNode struct {
@@ -34,7 +53,9 @@ type CharacterNode interface {
 }
 
 type LiteralNode struct {
-	Value byte
+	Value rune
+	// FoldCase makes the literal match any case of Value
+	FoldCase bool
 }
 
 func (n* LiteralNode) String() string {
@@ -47,6 +68,9 @@ func (n* LiteralNode) GetValue() string {
 
 type MetaCharacterNode struct {
 	Value string
+	// FoldCase makes a named class such as [:upper:] or \p{Lu} match any
+	// case of its characters
+	FoldCase bool
 }
 
 func (n* MetaCharacterNode) String() string {
@@ -58,26 +82,184 @@ func (n* MetaCharacterNode) GetValue() string {
 }
 
 func (n *StarNode) String() string {
-	return n.Child.String() + "*"
+	return n.Child.String() + "*" + quantifierSuffix(n.Lazy, n.Possessive)
+}
+
+type PlusNode struct {
+	Child      Node
+	Lazy       bool
+	Possessive bool
+}
+
+func (n *PlusNode) String() string {
+	return n.Child.String() + "+" + quantifierSuffix(n.Lazy, n.Possessive)
+}
+
+type QuestionNode struct {
+	Child      Node
+	Lazy       bool
+	Possessive bool
+}
+
+func (n *QuestionNode) String() string {
+	return n.Child.String() + "?" + quantifierSuffix(n.Lazy, n.Possessive)
+}
+
+func quantifierSuffix(lazy, possessive bool) string {
+	if lazy {
+		return "?"
+	}
+	if possessive {
+		return "+"
+	}
+	return ""
+}
+
+// RepeatNode is a counted repetition like {2}, {2,} or {2,5}; Max is -1 when
+// there is no upper bound.
+type RepeatNode struct {
+	Child      Node
+	Min        int
+	Max        int
+	Lazy       bool
+	Possessive bool
+}
+
+func (n *RepeatNode) String() string {
+	if n.Min == n.Max {
+		return fmt.Sprintf("%s{%d}%s", n.Child.String(), n.Min, quantifierSuffix(n.Lazy, n.Possessive))
+	}
+	if n.Max == -1 {
+		return fmt.Sprintf("%s{%d,}%s", n.Child.String(), n.Min, quantifierSuffix(n.Lazy, n.Possessive))
+	}
+	return fmt.Sprintf("%s{%d,%d}%s", n.Child.String(), n.Min, n.Max, quantifierSuffix(n.Lazy, n.Possessive))
+}
+
+// RangeNode is a character range such as a-z inside a CharList.
+type RangeNode struct {
+	From     rune
+	To       rune
+	FoldCase bool
+}
+
+func (n *RangeNode) String() string {
+	return string(n.From) + "-" + string(n.To)
+}
+
+func (n *RangeNode) GetValue() string {
+	return n.String()
 }
 
 type CharList struct {
-	Chars []CharacterNode
+	Chars   []CharacterNode
+	Negated bool
 }
 
 func (n *CharList) String() string {
 	str := "["
+	if n.Negated {
+		str += "^"
+	}
 	for _,cn := range n.Chars {
 		str += cn.String()
 	}
 	return str + "]"
 }
 
+// AssertionNode is a zero-width assertion such as ^, $ or \b that checks the
+// characters around the current position without consuming any of them.
+type AssertionNode struct {
+	Value string
+}
+
+func (n *AssertionNode) String() string {
+	return n.Value
+}
+
+// BackreferenceNode such as \1 matches the text most recently matched by the
+// capturing group with that Index. Only the backtracker can match it.
+type BackreferenceNode struct {
+	Index    int
+	FoldCase bool
+}
+
+func (n *BackreferenceNode) String() string {
+	return fmt.Sprintf("\\%d", n.Index)
+}
+
+// AtomicNode is an atomic group, (?>...): once Child has matched, the
+// backtracker does not try the other ways it could have matched.
+type AtomicNode struct {
+	Child Node
+}
+
+func (n *AtomicNode) String() string {
+	return "(?>" + n.Child.String() + ")"
+}
+
+// LookaroundNode is a zero-width assertion that Child matches right after the
+// current position, (?=...), or right before it when Behind is set, (?<=...).
+// Negated turns them into (?!...) and (?<!...). Only the backtracker can match
+// it.
+type LookaroundNode struct {
+	Child   Node
+	Behind  bool
+	Negated bool
+}
+
+func (n *LookaroundNode) String() string {
+	prefix := "(?"
+	if n.Behind {
+		prefix += "<"
+	}
+	if n.Negated {
+		prefix += "!"
+	} else {
+		prefix += "="
+	}
+	return prefix + n.Child.String() + ")"
+}
+
+type AlternationNode struct {
+	Alternatives []Node
+}
+
+func (n *AlternationNode) String() string {
+	str := ""
+	for i, alt := range n.Alternatives {
+		if i > 0 {
+			str += "|"
+		}
+		str += alt.String()
+	}
+	return str
+}
+
+// GroupNode is a parenthesized expression. Capturing groups are numbered from
+// 1 in the order of their opening parenthesis; Index is 0 for groups that do
+// not capture, such as (?:...) or (?i:...).
+type GroupNode struct {
+	Child Node
+	Index int
+	// Name is set for named groups such as (?P<name>...)
+	Name string
+}
+
+func (n *GroupNode) String() string {
+	return "(" + n.Child.String() + ")"
+}
+
 type NodeBuilder struct {
 }
 
-func (b NodeBuilder) Lit(c byte) *LiteralNode { return &LiteralNode{Value: c}}
+func (b NodeBuilder) Lit(c rune) *LiteralNode { return &LiteralNode{Value: c}}
+func (b NodeBuilder) FoldLit(c rune) *LiteralNode { return &LiteralNode{Value: c, FoldCase: true}}
 func (b NodeBuilder) Star(child Node) *StarNode { return &StarNode{Child: child}}
+func (b NodeBuilder) Plus(child Node) *PlusNode { return &PlusNode{Child: child}}
+func (b NodeBuilder) Question(child Node) *QuestionNode { return &QuestionNode{Child: child}}
+func (b NodeBuilder) Repeat(child Node, min, max int) *RepeatNode {
+	return &RepeatNode{Child: child, Min: min, Max: max}
+}
 func (b NodeBuilder) Seq(children ...Node) *SequenceNode { 
 	return &SequenceNode{ Children: children}
 }
@@ -85,10 +267,89 @@ func (b NodeBuilder) List(chars ...CharacterNode) *CharList {
 	return &CharList{ Chars: chars}
 }
 
+func (b NodeBuilder) NotList(chars ...CharacterNode) *CharList {
+	return &CharList{Chars: chars, Negated: true}
+}
+
+func (b NodeBuilder) Range(from, to rune) *RangeNode {
+	return &RangeNode{From: from, To: to}
+}
+
+func (b NodeBuilder) FoldRange(from, to rune) *RangeNode {
+	return &RangeNode{From: from, To: to, FoldCase: true}
+}
+
 func (b NodeBuilder) Meta(s string) *MetaCharacterNode {
 	return &MetaCharacterNode{Value: s}
 }
 
+func (b NodeBuilder) FoldMeta(s string) *MetaCharacterNode {
+	return &MetaCharacterNode{Value: s, FoldCase: true}
+}
+
+func (b NodeBuilder) Assert(s string) *AssertionNode {
+	return &AssertionNode{Value: s}
+}
+
+func (b NodeBuilder) Backref(index int) *BackreferenceNode {
+	return &BackreferenceNode{Index: index}
+}
+
+func (b NodeBuilder) Lookaround(child Node, behind, negated bool) *LookaroundNode {
+	return &LookaroundNode{Child: child, Behind: behind, Negated: negated}
+}
+
+func (b NodeBuilder) Alt(alternatives ...Node) *AlternationNode {
+	return &AlternationNode{Alternatives: alternatives}
+}
+
+// Lazy marks a quantifier built by Star, Plus, Question or Repeat as lazy.
+func (b NodeBuilder) Lazy(quantifier Node) Node {
+	switch n := quantifier.(type) {
+	case *StarNode:
+		n.Lazy = true
+	case *PlusNode:
+		n.Lazy = true
+	case *QuestionNode:
+		n.Lazy = true
+	case *RepeatNode:
+		n.Lazy = true
+	}
+	return quantifier
+}
+
+// Possessive marks a quantifier built by Star, Plus, Question or Repeat as
+// possessive.
+func (b NodeBuilder) Possessive(quantifier Node) Node {
+	switch n := quantifier.(type) {
+	case *StarNode:
+		n.Possessive = true
+	case *PlusNode:
+		n.Possessive = true
+	case *QuestionNode:
+		n.Possessive = true
+	case *RepeatNode:
+		n.Possessive = true
+	}
+	return quantifier
+}
+
+func (b NodeBuilder) Atomic(child Node) *AtomicNode {
+	return &AtomicNode{Child: child}
+}
+
+func (b NodeBuilder) Group(child Node) *GroupNode {
+	return &GroupNode{Child: child}
+}
+
+func (b NodeBuilder) Capture(index int, child Node) *GroupNode {
+	return &GroupNode{Child: child, Index: index}
+}
+
+func (b NodeBuilder) Named(index int, name string, child Node) *GroupNode {
+	return &GroupNode{Child: child, Index: index, Name: name}
+}
+
 func PrintAstTree(node Node, indentLevel int) {
 	indentSize := 2
 	indent := indentLevel * indentSize
@@ -97,27 +358,106 @@ func PrintAstTree(node Node, indentLevel int) {
 		fmt.Printf("%*sLiteral: '%s'\n", indent, "", n.String())
 	case *MetaCharacterNode:
 		fmt.Printf("%*sMeta: '%s'\n", indent, "", n.String())
+	case *AssertionNode:
+		fmt.Printf("%*sAssertion: '%s'\n", indent, "", n.String())
+	case *BackreferenceNode:
+		fmt.Printf("%*sBackreference: '%s'\n", indent, "", n.String())
+	case *LookaroundNode:
+		fmt.Printf("%*sLookaround: '%s'\n", indent, "", n.String())
+		PrintAstTree(n.Child, indentLevel+1)
+	case *AtomicNode:
+		fmt.Printf("%*sAtomic:\n", indent, "")
+		PrintAstTree(n.Child, indentLevel+1)
 	case *CharList:
-		fmt.Printf("%*sCharList:\n", indent, "")
+		if n.Negated {
+			fmt.Printf("%*sNegated CharList:\n", indent, "")
+		} else {
+			fmt.Printf("%*sCharList:\n", indent, "")
+		}
 		for _, ch := range n.Chars {
 			switch c := ch.(type) {
 			case *LiteralNode:
 				fmt.Printf("%*sLiteral: '%s'\n", indent+indentSize, "", c.String())
 			case *MetaCharacterNode:
 				fmt.Printf("%*sMeta: '%s'\n", indent+indentSize, "", c.String())
+			case *RangeNode:
+				fmt.Printf("%*sRange: '%s'\n", indent+indentSize, "", c.String())
 			default:
 				fmt.Printf("%*sUnknown CharacterNode\n", indent+indentSize, "")
 			}
 		}
 	case *StarNode:
-		fmt.Printf("%*sStar:\n", indent, "")
+		fmt.Printf("%*sStar%s:\n", indent, "", quantifierSuffix(n.Lazy, n.Possessive))
+		PrintAstTree(n.Child, indentLevel+1)
+	case *PlusNode:
+		fmt.Printf("%*sPlus%s:\n", indent, "", quantifierSuffix(n.Lazy, n.Possessive))
+		PrintAstTree(n.Child, indentLevel+1)
+	case *QuestionNode:
+		fmt.Printf("%*sQuestion%s:\n", indent, "", quantifierSuffix(n.Lazy, n.Possessive))
+		PrintAstTree(n.Child, indentLevel+1)
+	case *RepeatNode:
+		fmt.Printf("%*sRepeat{%d,%d}%s:\n", indent, "", n.Min, n.Max, quantifierSuffix(n.Lazy, n.Possessive))
 		PrintAstTree(n.Child, indentLevel+1)
 	case *SequenceNode:
 		fmt.Printf("%*sSequence:\n", indent, "")
 		for _, child := range n.Children {
 			PrintAstTree(child, indentLevel+2)
 		}
+	case *AlternationNode:
+		fmt.Printf("%*sAlternation:\n", indent, "")
+		for _, alt := range n.Alternatives {
+			PrintAstTree(alt, indentLevel+1)
+		}
+	case *GroupNode:
+		if n.Name != "" {
+			fmt.Printf("%*sGroup %d <%s>:\n", indent, "", n.Index, n.Name)
+		} else {
+			fmt.Printf("%*sGroup:\n", indent, "")
+		}
+		PrintAstTree(n.Child, indentLevel+1)
 	default:
 		fmt.Printf("%*sUnknown Node type\n", indent, "")
 	}
 }
+
+// SubexpNames returns the names of the capturing groups in node, indexed by
+// group number. Element 0 stands for the whole match and, like every unnamed
+// group, is the empty string.
+func SubexpNames(node Node) []string {
+	names := []string{""}
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *GroupNode:
+			if n.Index >= len(names) {
+				names = append(names, make([]string, n.Index-len(names)+1)...)
+			}
+			if n.Index > 0 {
+				names[n.Index] = n.Name
+			}
+			walk(n.Child)
+		case *SequenceNode:
+			for _, child := range n.Children {
+				walk(child)
+			}
+		case *AlternationNode:
+			for _, alt := range n.Alternatives {
+				walk(alt)
+			}
+		case *LookaroundNode:
+			walk(n.Child)
+		case *AtomicNode:
+			walk(n.Child)
+		case *StarNode:
+			walk(n.Child)
+		case *PlusNode:
+			walk(n.Child)
+		case *QuestionNode:
+			walk(n.Child)
+		case *RepeatNode:
+			walk(n.Child)
+		}
+	}
+	walk(node)
+	return names
+}
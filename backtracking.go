@@ -2,23 +2,28 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"unicode"
+	"unicode/utf8"
 )
 
 func printPosition(input string, pos int, label string) {
-	if pos >= len(input) {
-		for i:=len(input); i<=pos; i++ {
-			input += "_"
+	// pos is a byte offset, the caret goes under the character starting there
+	pos = utf8.RuneCountInString(input[:min(pos, len(input))])
+	chars := []rune(input)
+	if pos >= len(chars) {
+		for i:=len(chars); i<=pos; i++ {
+			chars = append(chars, '_')
 		}
 	} else {
-		input += " "
+		chars = append(chars, ' ')
 	}
-	for _, ch := range input {
+	for _, ch := range chars {
 		fmt.Printf("%c ", ch)
 	}
 	fmt.Printf("--> %s\n", label)
 
-	for i := 0; i < len(input); i++ {
+	for i := 0; i < len(chars); i++ {
 		if i == pos {
 			fmt.Print("^ ")
 		} else {
@@ -28,97 +33,409 @@ func printPosition(input string, pos int, label string) {
 	fmt.Println()
 }
 
-func matchNode(node Node, input string, pos int) (bool, int) {
+// continuation is called with the position reached after a node matched and
+// decides whether the rest of the pattern matches from there. The capture
+// slots passed along with it hold the groups matched so far, in the layout
+// FindSubmatch uses.
+type continuation func(pos int) (bool, int)
+
+func matchNode(node Node, input string, caps []int, pos int, next continuation) (bool, int) {
 	switch n := node.(type) {
 
 	case *LiteralNode:
 		printPosition(input, pos, string(n.Value))
-		if pos < len(input) && input[pos] == n.Value {
-			return true, pos + 1
+		c, size := utf8.DecodeRuneInString(input[pos:])
+		if size > 0 && (c == n.Value || n.FoldCase && equalFold(n.Value, c)) {
+			return next(pos + size)
 		}
 		return false, pos
 
 	case *MetaCharacterNode:
 		printPosition(input, pos,n.Value)
-		if pos >= len(input) {
+		c, size := utf8.DecodeRuneInString(input[pos:])
+		if size == 0 {
 			return false, pos
 		}
-		c := []rune(input)[pos]
 		switch n.Value {
 		case DOT:
-			return true, pos + 1
+			if c != '\n' {
+				return next(pos + size)
+			}
+		case ANY_CHAR:
+			return next(pos + size)
 		case WHITESPACE:
 			if unicode.IsSpace(c) {
-				return true, pos + 1
+				return next(pos + size)
 			}
 		case NONWHITESPACE:
 			if !unicode.IsSpace(c) {
-				return true, pos + 1
+				return next(pos + size)
+			}
+		case DIGIT:
+			if '0' <= c && c <= '9' {
+				return next(pos + size)
+			}
+		case NONDIGIT:
+			if c < '0' || '9' < c {
+				return next(pos + size)
+			}
+		case WORD:
+			if isWordChar(c) {
+				return next(pos + size)
+			}
+		case NONWORD:
+			if !isWordChar(c) {
+				return next(pos + size)
+			}
+		default:
+			if inNamedClass(n.Value, c, n.FoldCase) {
+				return next(pos + size)
 			}
 		}
 		return false, pos
 
+	case *AssertionNode:
+		printPosition(input, pos, n.Value)
+		prev, following := surrounding(input, pos)
+		if assertionHolds(n.Value, prev, following) {
+			return next(pos)
+		}
+		return false, pos
+
+	case *BackreferenceNode:
+		printPosition(input, pos, n.String())
+		start, end := caps[2*n.Index], caps[2*n.Index+1]
+		if start < 0 {
+			// the group has not matched, so neither can the reference
+			return false, pos
+		}
+		if after, ok := matchText(input[start:end], input, pos, n.FoldCase); ok {
+			return next(after)
+		}
+		return false, pos
+
+	case *AtomicNode:
+		return matchAtomic(input, caps, pos, next, func(next continuation) (bool, int) {
+			return matchNode(n.Child, input, caps, pos, next)
+		})
+
+	case *LookaroundNode:
+		printPosition(input, pos, n.String())
+		saved := slices.Clone(caps)
+		if matchLookaround(n, input, caps, pos) != n.Negated {
+			if n.Negated {
+				// the child did not match, so neither did its groups
+				copy(caps, saved)
+			}
+			if ok, endPos := next(pos); ok {
+				return true, endPos
+			}
+		}
+		// the groups set by an abandoned lookaround must not be seen by a
+		// backreference on another branch
+		copy(caps, saved)
+		return false, pos
+
 	case *SequenceNode:
-		current := pos
-		for i := 0; i < len(n.Children); i++ {
-			child := n.Children[i]
-			if star, ok := child.(*StarNode); ok {
-				printPosition(input, current, star.String())
-				positions := []int{current}
-				nextPos := current
-				for {
-					ok, next := matchNode(star.Child, input, nextPos)
-					if !ok || next == nextPos {
-						break
-					}
-					nextPos = next
-					positions = append(positions, nextPos)
-				}
+		return matchSequence(n.Children, input, caps, pos, next)
 
-				for j := len(positions) - 1; j >= 0; j-- {
-					ok, endPos := matchNode(&SequenceNode{Children: n.Children[i+1:]}, input, positions[j])
-					if ok {
-						return true, endPos
-					}
-				}
-				return false, pos
+	case *StarNode, *PlusNode, *QuestionNode, *RepeatNode:
+		return matchRepeat(n, input, caps, pos, next)
+
+	case *AlternationNode:
+		for _, alt := range n.Alternatives {
+			ok, endPos := matchNode(alt, input, caps, pos, next)
+			if ok {
+				return true, endPos
 			}
+		}
+		return false, pos
 
-			ok, next := matchNode(child, input, current)
+	case *GroupNode:
+		if n.Index == 0 {
+			return matchNode(n.Child, input, caps, pos, next)
+		}
+		return matchNode(n.Child, input, caps, pos, func(end int) (bool, int) {
+			slot := 2 * n.Index
+			previousStart, previousEnd := caps[slot], caps[slot+1]
+			caps[slot], caps[slot+1] = pos, end
+			ok, endPos := next(end)
 			if !ok {
-				return false, pos
+				// the rest of the pattern failed, so this match of the group
+				// does not count
+				caps[slot], caps[slot+1] = previousStart, previousEnd
 			}
-			current = next
+			return ok, endPos
+		})
+
+	case *RangeNode:
+		printPosition(input, pos, n.String())
+		c, size := utf8.DecodeRuneInString(input[pos:])
+		if size > 0 && inRange(n.From, n.To, c, n.FoldCase) {
+			return next(pos + size)
 		}
-		return true, current
+		return false, pos
 
 	case *CharList:
-		if pos >= len(input) {
+		_, size := utf8.DecodeRuneInString(input[pos:])
+		if size == 0 {
 			return false, pos
 		}
+		matched := false
 		for _, chNode := range n.Chars {
-			ok, next := matchNode(chNode, input, pos)
-			if ok {
-				return true, next
+			if ok, _ := matchNode(chNode, input, caps, pos, accept); ok {
+				matched = true
+				break
 			}
 		}
+		if matched != n.Negated {
+			return next(pos + size)
+		}
 		return false, pos
 	}
 
 	return false, pos
 }
 
+// matchLookaround reports whether the child of n matches starting at pos or,
+// for a lookbehind, ending at pos. Once it has, the match is not retried if
+// the rest of the pattern fails.
+func matchLookaround(n *LookaroundNode, input string, caps []int, pos int) bool {
+	if !n.Behind {
+		ok, _ := matchNode(n.Child, input, caps, pos, accept)
+		return ok
+	}
+	endsHere := func(end int) (bool, int) {
+		return end == pos, end
+	}
+	for start := pos; start >= 0; start-- {
+		if start < len(input) && !utf8.RuneStart(input[start]) {
+			continue
+		}
+		if ok, _ := matchNode(n.Child, input, caps, start, endsHere); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchText matches text at pos in input, ignoring case if fold is set, and
+// returns the position after it.
+func matchText(text string, input string, pos int, fold bool) (int, bool) {
+	for _, want := range text {
+		c, size := utf8.DecodeRuneInString(input[pos:])
+		if size == 0 || c != want && !(fold && equalFold(want, c)) {
+			return pos, false
+		}
+		pos += size
+	}
+	return pos, true
+}
+
+func matchSequence(children []Node, input string, caps []int, pos int, next continuation) (bool, int) {
+	if len(children) == 0 {
+		return next(pos)
+	}
+	return matchNode(children[0], input, caps, pos, func(p int) (bool, int) {
+		return matchSequence(children[1:], input, caps, p, next)
+	})
+}
+
+// repeat describes a quantifier node: its child, its bounds, with max -1 when
+// unbounded, whether it is lazy or possessive and whether it is a counted
+// repetition such as x{2,4}.
+type repeat struct {
+	child      Node
+	min        int
+	max        int
+	lazy       bool
+	possessive bool
+	counted    bool
+}
+
+func repetition(node Node) repeat {
+	switch n := node.(type) {
+	case *StarNode:
+		return repeat{n.Child, 0, -1, n.Lazy, n.Possessive, false}
+	case *PlusNode:
+		return repeat{n.Child, 1, -1, n.Lazy, n.Possessive, false}
+	case *QuestionNode:
+		return repeat{n.Child, 0, 1, n.Lazy, n.Possessive, false}
+	case *RepeatNode:
+		return repeat{n.Child, n.Min, n.Max, n.Lazy, n.Possessive, true}
+	}
+	panic(fmt.Sprintf("Unknown quantifier type %T", node))
+}
+
+func matchRepeat(node Node, input string, caps []int, pos int, next continuation) (bool, int) {
+	printPosition(input, pos, node.String())
+	r := repetition(node)
+	if !isSingleCharacter(r.child) {
+		if r.possessive {
+			return matchAtomic(input, caps, pos, next, func(next continuation) (bool, int) {
+				return matchRepeatFrom(r, 0, input, caps, pos, next)
+			})
+		}
+		return matchRepeatFrom(r, 0, input, caps, pos, next)
+	}
+
+	positions := []int{pos}
+	nextPos := pos
+	for r.max == -1 || len(positions) <= r.max {
+		ok, end := matchNode(r.child, input, caps, nextPos, accept)
+		if !ok || end == nextPos {
+			break
+		}
+		nextPos = end
+		positions = append(positions, nextPos)
+	}
+
+	if len(positions) <= r.min {
+		return false, pos
+	}
+	// a greedy repetition tries the longest run first, a lazy one the shortest
+	ends := slices.Clone(positions[r.min:])
+	if !r.lazy {
+		slices.Reverse(ends)
+	}
+	if r.possessive {
+		// a possessive one gives nothing back: the shorter runs are dropped
+		ends = ends[:1]
+	}
+	for _, end := range ends {
+		ok, endPos := next(end)
+		if ok {
+			return true, endPos
+		}
+	}
+	return false, pos
+}
+
+// matchRepeatFrom tries one more iteration of the child after count iterations
+// have matched, falling back to the continuation once min is satisfied. A lazy
+// repetition tries the continuation first.
+func matchRepeatFrom(r repeat, count int, input string, caps []int, pos int, next continuation) (bool, int) {
+	if r.lazy && count >= r.min {
+		if ok, endPos := next(pos); ok {
+			return true, endPos
+		}
+	}
+	if r.max == -1 || count < r.max {
+		ok, endPos := matchNode(r.child, input, caps, pos, func(p int) (bool, int) {
+			if p == pos && (!r.counted || count >= r.min) {
+				// an empty iteration would repeat forever, so it is the last
+				// one, and it only stands where the automata let it
+				if !r.allowsEmpty(count) {
+					return false, p
+				}
+				return next(p)
+			}
+			return matchRepeatFrom(r, count+1, input, caps, p, next)
+		})
+		if ok {
+			return true, endPos
+		}
+	}
+	if !r.lazy && count >= r.min {
+		return next(pos)
+	}
+	return false, pos
+}
+
+// allowsEmpty reports whether an empty iteration may follow count iterations,
+// ending the repetition. The automata drop a thread entering the states of the
+// child again at the same position, so a loop only takes an empty iteration as
+// its first one. Counted repetitions are compiled into copies of the child
+// instead: the required copies may all be empty and so may each optional one,
+// while the loop following them when there is no upper bound is like any
+// other.
+func (r repeat) allowsEmpty(count int) bool {
+	return count == 0 || r.counted && (r.max != -1 || count == r.min)
+}
+
+// matchAtomic runs match and continues from its first match only. The other
+// ways match could have succeeded are never tried, so a failure of next is
+// final and the captures match set are undone.
+func matchAtomic(input string, caps []int, pos int, next continuation, match func(next continuation) (bool, int)) (bool, int) {
+	saved := slices.Clone(caps)
+	if ok, end := match(accept); ok {
+		if ok, endPos := next(end); ok {
+			return true, endPos
+		}
+	}
+	copy(caps, saved)
+	return false, pos
+}
+
+// isSingleCharacter reports whether node always consumes exactly one character,
+// in which case it has a single way to match and repetitions of it never need
+// to be retried.
+func isSingleCharacter(node Node) bool {
+	switch node.(type) {
+	case *LiteralNode, *MetaCharacterNode, *CharList:
+		return true
+	}
+	return false
+}
+
+func accept(pos int) (bool, int) {
+	return true, pos
+}
+
 func MatchBacktrack(ast Node, input string) bool {
-	ok, next := matchNode(ast, input, 0)
+	caps := newCaptures(ast)
+	ok, next := matchNode(ast, input, caps, 0, func(pos int) (bool, int) {
+		return pos == len(input), pos
+	})
 	return ok && next == len(input)
 }
 
 func MatchBacktrackPartial(ast Node, input string) bool {
-	for start := 0; start <= len(input); start++ {
-		ok, _ := matchNode(ast, input, start)
+	return FindBacktrack(ast, input) != nil
+}
+
+// FindBacktrack returns the byte offsets [start, end] of the first match the
+// backtracker reaches: the leftmost start and, from there, whatever the first
+// successful alternative and the greediest quantifiers produce (Perl's
+// leftmost-first rule). It returns nil when there is no match.
+func FindBacktrack(ast Node, input string) []int {
+	if match := FindBacktrackSubmatch(ast, input); match != nil {
+		return match[:2]
+	}
+	return nil
+}
+
+// FindBacktrackSubmatch is FindBacktrack with the offsets of every capturing
+// group appended, laid out like the result of FindSubmatch.
+func FindBacktrackSubmatch(ast Node, input string) []int {
+	caps := newCaptures(ast)
+	for start := 0; start <= len(input); {
+		ok, end := matchNode(ast, input, caps, start, accept)
 		if ok {
-			return true
+			caps[0], caps[1] = start, end
+			return caps
+		}
+		if start == len(input) {
+			break
 		}
+		_, size := utf8.DecodeRuneInString(input[start:])
+		start += size
 	}
-	return false
+	return nil
+}
+
+// FindBacktrackNamed returns the text of the named groups in the first match
+// FindBacktrack finds, keyed by group name. Groups that did not take part in
+// the match are left out; the result is nil when there is no match.
+func FindBacktrackNamed(ast Node, input string) map[string]string {
+	return namedGroups(SubexpNames(ast), FindBacktrackSubmatch(ast, input), input)
+}
+
+// newCaptures returns the capture slots for the groups of ast, all unset.
+func newCaptures(ast Node) []int {
+	caps := make([]int, 2*len(SubexpNames(ast)))
+	for i := range caps {
+		caps[i] = -1
+	}
+	return caps
 }
@@ -0,0 +1,341 @@
+// Package ebnf reads grammars written in the EBNF notation of grammar.ebnf
+// and generates random sentences from them.
+//
+// A grammar is a list of productions, Name ::= Expression. Expressions are
+// made of names, quoted literals such as '(?' or "'" where a backslash
+// escapes the next character, character classes such as [a-z] or [^\\],
+// parentheses, alternatives separated by | and the postfix operators ?, *
+// and +. Comments are written /* like this */.
+package ebnf
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expression is one of Name, Literal, Class, Sequence, Alternatives or
+// Repetition.
+type Expression interface{}
+
+// Name refers to the production of that name.
+type Name string
+
+// Literal stands for its own text.
+type Literal string
+
+// Class stands for a single character within one of its ranges, or outside
+// all of them when it is negated. Each range is a pair of its first and last
+// characters.
+type Class struct {
+	Ranges  [][2]rune
+	Negated bool
+}
+
+// Contains reports whether char is one of the characters the class stands
+// for.
+func (c Class) Contains(char rune) bool {
+	for _, r := range c.Ranges {
+		if r[0] <= char && char <= r[1] {
+			return !c.Negated
+		}
+	}
+	return c.Negated
+}
+
+// Sequence stands for its expressions one after the other.
+type Sequence []Expression
+
+// Alternatives stands for any one of its expressions.
+type Alternatives []Expression
+
+// Repetition stands for Expression repeated at least Min times and at most
+// Max times, with Max -1 when there is no upper bound.
+type Repetition struct {
+	Expression Expression
+	Min        int
+	Max        int
+}
+
+// Grammar maps the name of every production to its expression.
+type Grammar map[string]Expression
+
+// Parse reads a grammar and checks that every name it uses has a production.
+func Parse(text string) (Grammar, error) {
+	p := &parser{input: text, grammar: Grammar{}}
+	if err := p.parseGrammar(); err != nil {
+		return nil, err
+	}
+	for name, expression := range p.grammar {
+		if err := p.grammar.checkNames(expression); err != nil {
+			return nil, fmt.Errorf("production %s: %w", name, err)
+		}
+	}
+	return p.grammar, nil
+}
+
+func (g Grammar) checkNames(expression Expression) error {
+	switch e := expression.(type) {
+	case Name:
+		if _, ok := g[string(e)]; !ok {
+			return fmt.Errorf("undefined name %s", e)
+		}
+	case Sequence:
+		for _, item := range e {
+			if err := g.checkNames(item); err != nil {
+				return err
+			}
+		}
+	case Alternatives:
+		for _, alt := range e {
+			if err := g.checkNames(alt); err != nil {
+				return err
+			}
+		}
+	case Repetition:
+		return g.checkNames(e.Expression)
+	}
+	return nil
+}
+
+type parser struct {
+	input    string
+	position int
+	grammar  Grammar
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.input[:p.position], "\n")
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips the whitespace and comments at the current position.
+func (p *parser) skipSpace() error {
+	for p.position < len(p.input) {
+		rest := p.input[p.position:]
+		char, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case unicode.IsSpace(char):
+			p.position += size
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest, "*/")
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.position += end + 2
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() string {
+	return p.input[p.position:]
+}
+
+func (p *parser) parseGrammar() error {
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if p.position == len(p.input) {
+			return nil
+		}
+		name := p.readName()
+		if name == "" {
+			return p.errorf("expected a production name")
+		}
+		if _, ok := p.grammar[name]; ok {
+			return p.errorf("duplicate production %s", name)
+		}
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(p.peek(), "::=") {
+			return p.errorf("expected ::= after %s", name)
+		}
+		p.position += len("::=")
+		expression, err := p.parseAlternatives()
+		if err != nil {
+			return err
+		}
+		p.grammar[name] = expression
+	}
+}
+
+func (p *parser) readName() string {
+	start := p.position
+	for p.position < len(p.input) {
+		char, size := utf8.DecodeRuneInString(p.peek())
+		if !(char == '_' || unicode.IsLetter(char) || p.position > start && unicode.IsDigit(char)) {
+			break
+		}
+		p.position += size
+	}
+	return p.input[start:p.position]
+}
+
+// atProductionEnd reports whether the expression being read ends here, at the
+// end of the input or before the name starting the next production.
+func (p *parser) atProductionEnd() bool {
+	if p.position == len(p.input) {
+		return true
+	}
+	start := p.position
+	defer func() { p.position = start }()
+	if p.readName() == "" {
+		return false
+	}
+	if p.skipSpace() != nil {
+		return false
+	}
+	return strings.HasPrefix(p.peek(), "::=")
+}
+
+func (p *parser) parseAlternatives() (Expression, error) {
+	var alternatives Alternatives
+	for {
+		sequence, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, sequence)
+		if !strings.HasPrefix(p.peek(), "|") {
+			break
+		}
+		p.position++
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return alternatives, nil
+}
+
+func (p *parser) parseSequence() (Expression, error) {
+	var sequence Sequence
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.atProductionEnd() || strings.HasPrefix(p.peek(), "|") || strings.HasPrefix(p.peek(), ")") {
+			break
+		}
+		item, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, p.parsePostfix(item))
+	}
+	if len(sequence) == 1 {
+		return sequence[0], nil
+	}
+	return sequence, nil
+}
+
+func (p *parser) parsePostfix(item Expression) Expression {
+	for p.position < len(p.input) {
+		switch p.input[p.position] {
+		case '?':
+			item = Repetition{Expression: item, Min: 0, Max: 1}
+		case '*':
+			item = Repetition{Expression: item, Min: 0, Max: -1}
+		case '+':
+			item = Repetition{Expression: item, Min: 1, Max: -1}
+		default:
+			return item
+		}
+		p.position++
+	}
+	return item
+}
+
+func (p *parser) parsePrimary() (Expression, error) {
+	switch rest := p.peek(); {
+	case strings.HasPrefix(rest, "("):
+		p.position++
+		expression, err := p.parseAlternatives()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(p.peek(), ")") {
+			return nil, p.errorf("expected )")
+		}
+		p.position++
+		return expression, nil
+	case strings.HasPrefix(rest, "'"), strings.HasPrefix(rest, `"`):
+		return p.parseLiteral()
+	case strings.HasPrefix(rest, "["):
+		return p.parseClass()
+	}
+	if name := p.readName(); name != "" {
+		return Name(name), nil
+	}
+	char, _ := utf8.DecodeRuneInString(p.peek())
+	return nil, p.errorf("unexpected %q", char)
+}
+
+// readChar reads a character, or the character after a backslash.
+func (p *parser) readChar() (rune, bool) {
+	char, size := utf8.DecodeRuneInString(p.peek())
+	if char == '\\' && p.position+size < len(p.input) {
+		p.position += size
+		char, size = utf8.DecodeRuneInString(p.peek())
+		p.position += size
+		return char, true
+	}
+	p.position += size
+	return char, false
+}
+
+func (p *parser) parseLiteral() (Expression, error) {
+	quote := p.input[p.position]
+	p.position++
+	var text strings.Builder
+	for {
+		if p.position == len(p.input) {
+			return nil, p.errorf("unterminated literal")
+		}
+		char, escaped := p.readChar()
+		if char == rune(quote) && !escaped {
+			break
+		}
+		text.WriteRune(char)
+	}
+	if text.Len() == 0 {
+		return nil, p.errorf("empty literal")
+	}
+	return Literal(text.String()), nil
+}
+
+func (p *parser) parseClass() (Expression, error) {
+	p.position++
+	class := Class{}
+	if strings.HasPrefix(p.peek(), "^") {
+		class.Negated = true
+		p.position++
+	}
+	for {
+		if p.position == len(p.input) {
+			return nil, p.errorf("unterminated character class")
+		}
+		from, escaped := p.readChar()
+		if from == ']' && !escaped {
+			break
+		}
+		to := from
+		if strings.HasPrefix(p.peek(), "-") && !strings.HasPrefix(p.peek(), "-]") {
+			p.position++
+			to, _ = p.readChar()
+			if to < from {
+				return nil, p.errorf("invalid range %c-%c", from, to)
+			}
+		}
+		class.Ranges = append(class.Ranges, [2]rune{from, to})
+	}
+	if len(class.Ranges) == 0 {
+		return nil, p.errorf("empty character class")
+	}
+	return class, nil
+}
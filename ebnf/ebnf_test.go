@@ -0,0 +1,211 @@
+package ebnf
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	grammar, err := Parse(`
+		/* a list of numbers */
+		List   ::= '[' ( Number ( ',' Number )* )? ']'
+		Number ::= '-'? [1-9] [0-9]* | "0"
+		Quote  ::= '\'' [^'\\\]] '\''`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	number := Sequence{Literal(","), Name("Number")}
+	want := Grammar{
+		"List": Sequence{
+			Literal("["),
+			Repetition{Sequence{Name("Number"), Repetition{number, 0, -1}}, 0, 1},
+			Literal("]"),
+		},
+		"Number": Alternatives{
+			Sequence{
+				Repetition{Literal("-"), 0, 1},
+				Class{Ranges: [][2]rune{{'1', '9'}}},
+				Repetition{Class{Ranges: [][2]rune{{'0', '9'}}}, 0, -1},
+			},
+			Literal("0"),
+		},
+		"Quote": Sequence{
+			Literal("'"),
+			Class{Ranges: [][2]rune{{'\'', '\''}, {'\\', '\\'}, {']', ']'}}, Negated: true},
+			Literal("'"),
+		},
+	}
+	if !reflect.DeepEqual(grammar, want) {
+		t.Errorf("Parse = %#v, want %#v", grammar, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"A ::= 'a'\nA ::= 'b'", "line 2: duplicate production A"},
+		{"A 'a'", "line 1: expected ::= after A"},
+		{"A ::= 'a", "line 1: unterminated literal"},
+		{"A ::= ''", "line 1: empty literal"},
+		{"A ::= [a-z", "line 1: unterminated character class"},
+		{"A ::= []]", "line 1: empty character class"},
+		{"A ::= [z-a]", "line 1: invalid range z-a"},
+		{"A ::= ('a'", "line 1: expected )"},
+		{"A ::= 'a' /* b", "line 1: unterminated comment"},
+		{"\n\nA ::= 'a' @", "line 3: unexpected '@'"},
+		{"::= 'a'", "line 1: expected a production name"},
+		{"A ::= B 'a'", "production A: undefined name B"},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.text)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("Parse(%q) error = %v, want %s", c.text, err, c.want)
+		}
+	}
+}
+
+// TestGenerate checks generated sentences against regular expressions
+// describing the same languages.
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		grammar string
+		want    string
+	}{
+		{`Number ::= '-'? [1-9] [0-9]* | '0'`, `-?[1-9][0-9]*|0`},
+		{`List ::= '(' Item ( ',' Item )* ')'  Item ::= [a-c]+ | List`, `[(),a-c]+`},
+		{`Word ::= [^a-zA-Z ]+`, `[^a-zA-Z ]+`},
+		{`Greeting ::= ( 'hello' | "hi" ) ' '+ Name?  Name ::= [A-Z] [a-z]*`, `(hello|hi) +([A-Z][a-z]*)?`},
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, c := range cases {
+		grammar, err := Parse(c.grammar)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", c.grammar, err)
+		}
+		start := strings.Fields(c.grammar)[0]
+		want := regexp.MustCompile("^(?:" + c.want + ")$")
+		for i := 0; i < 100; i++ {
+			sentence, err := NewGenerator(grammar, r, 5).Generate(start)
+			if err != nil {
+				t.Fatalf("Generate(%s) failed: %v", start, err)
+			}
+			if !want.MatchString(sentence) {
+				t.Errorf("Generate(%s) = %q, which does not match %s", start, sentence, c.want)
+			}
+		}
+	}
+}
+
+func TestGenerateDepth(t *testing.T) {
+	grammar, err := Parse(`List ::= '(' List* ')'`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for depth := 1; depth <= 5; depth++ {
+		for i := 0; i < 20; i++ {
+			sentence, err := NewGenerator(grammar, r, depth).Generate("List")
+			if err != nil {
+				t.Fatalf("Generate(List) failed: %v", err)
+			}
+			nesting, deepest := 0, 0
+			for _, char := range sentence {
+				if char == '(' {
+					nesting++
+					deepest = max(deepest, nesting)
+				} else {
+					nesting--
+				}
+			}
+			if deepest > depth {
+				t.Errorf("Generate(List) at depth %d = %s, nesting %d deep", depth, sentence, deepest)
+			}
+		}
+	}
+}
+
+func TestGenerateChecks(t *testing.T) {
+	grammar, err := Parse(`
+		Declarations ::= Declaration+
+		Declaration  ::= 'var ' Variable ';' | 'use ' Use ';'
+		Variable     ::= [a-d]
+		Use          ::= [a-d]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		// a variable is used only once declared, and declared only once
+		declared := make(map[string]bool)
+		g := NewGenerator(grammar, r, 5)
+		g.Checks = map[string]func(text string) bool{
+			"Variable": func(text string) bool {
+				if declared[text] {
+					return false
+				}
+				declared[text] = true
+				return true
+			},
+			"Use": func(text string) bool {
+				return declared[text]
+			},
+		}
+		sentence, err := g.Generate("Declarations")
+		if err != nil {
+			t.Fatalf("Generate(Declarations) failed: %v", err)
+		}
+		seen := make(map[string]bool)
+		for _, declaration := range strings.Split(strings.TrimSuffix(sentence, ";"), ";") {
+			keyword, variable, _ := strings.Cut(declaration, " ")
+			if keyword == "var" == seen[variable] {
+				t.Errorf("Generate(Declarations) = %s, with %s misplaced", sentence, declaration)
+				break
+			}
+			seen[variable] = true
+		}
+	}
+
+	g := NewGenerator(grammar, r, 5)
+	g.Checks = map[string]func(text string) bool{
+		"Declaration": func(text string) bool { return false },
+	}
+	if sentence, err := g.Generate("Declarations"); err == nil {
+		t.Errorf("Generate(Declarations) = %s, want an error as every declaration is refused", sentence)
+	}
+}
+
+func TestGenerateTerminals(t *testing.T) {
+	grammar, err := Parse(`Call ::= Function '()'  Function ::= [a-z]+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	functions := []string{"len", "cap", "min"}
+	g := NewGenerator(grammar, rand.New(rand.NewSource(1)), 5)
+	g.Terminals = map[string]func(r *rand.Rand) string{
+		"Function": func(r *rand.Rand) string { return functions[r.Intn(len(functions))] },
+	}
+	for i := 0; i < 20; i++ {
+		sentence, err := g.Generate("Call")
+		if err != nil {
+			t.Fatalf("Generate(Call) failed: %v", err)
+		}
+		if !regexp.MustCompile(`^(len|cap|min)\(\)$`).MatchString(sentence) {
+			t.Errorf("Generate(Call) = %s, want a call of %v", sentence, functions)
+		}
+	}
+}
+
+func TestGenerateUndefined(t *testing.T) {
+	grammar, err := Parse(`A ::= 'a'`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := NewGenerator(grammar, rand.New(rand.NewSource(1)), 5).Generate("B"); err == nil || err.Error() != "undefined name B" {
+		t.Errorf("Generate(B) error = %v, want undefined name B", err)
+	}
+}
@@ -0,0 +1,213 @@
+package ebnf
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Generator writes random sentences of a grammar.
+type Generator struct {
+	Grammar Grammar
+	Rand    *rand.Rand
+	// MaxDepth bounds how deeply productions nest in a sentence. Once it is
+	// reached, only the alternatives that end soonest are taken and optional
+	// parts are left out.
+	MaxDepth int
+	// Universe holds the characters a negated class may stand for.
+	Universe []rune
+	// Checks holds, by production name, the conditions a grammar cannot
+	// express, such as a backreference needing its group. A check is given
+	// the text generated for the production and may record it; when it
+	// refuses it, the production is generated again, and after a few failed
+	// attempts the enclosing alternatives or repetitions make do without it.
+	Checks map[string]func(text string) bool
+	// Terminals generates the text of the named productions directly, for
+	// those taking their values from a table a grammar cannot list.
+	Terminals map[string]func(r *rand.Rand) string
+
+	minDepths map[string]int
+}
+
+// attempts is how many times a production refused by its check is retried.
+const attempts = 10
+
+// DefaultUniverse is printable ASCII and a few letters beyond it.
+var DefaultUniverse = []rune(" !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~éçğüşöıΩж日")
+
+// NewGenerator returns a generator for grammar using r for its choices.
+func NewGenerator(grammar Grammar, r *rand.Rand, maxDepth int) *Generator {
+	return &Generator{Grammar: grammar, Rand: r, MaxDepth: maxDepth, Universe: DefaultUniverse}
+}
+
+// Generate returns a random sentence of the production start.
+func (g *Generator) Generate(start string) (string, error) {
+	if _, ok := g.Grammar[start]; !ok {
+		return "", fmt.Errorf("undefined name %s", start)
+	}
+	if g.minDepths == nil {
+		g.minDepths = g.Grammar.minDepths()
+	}
+	var text strings.Builder
+	if !g.generate(&text, Name(start), 0) {
+		return "", fmt.Errorf("no sentence of %s passes the checks", start)
+	}
+	return text.String(), nil
+}
+
+// generate appends a sentence of expression at depth to text and reports
+// whether it could; on failure text is left as it was.
+func (g *Generator) generate(text *strings.Builder, expression Expression, depth int) bool {
+	switch e := expression.(type) {
+	case Literal:
+		text.WriteString(string(e))
+	case Class:
+		char, ok := g.pickChar(e)
+		if !ok {
+			return false
+		}
+		text.WriteRune(char)
+	case Name:
+		return g.generateName(text, string(e), depth)
+	case Sequence:
+		var items strings.Builder
+		for _, item := range e {
+			if !g.generate(&items, item, depth) {
+				return false
+			}
+		}
+		text.WriteString(items.String())
+	case Alternatives:
+		// the alternatives too deep for what is left of MaxDepth are only
+		// tried when none of the others fits
+		var fitting, others []Expression
+		for _, alt := range e {
+			if depth+g.minDepth(alt) <= g.MaxDepth {
+				fitting = append(fitting, alt)
+			} else {
+				others = append(others, alt)
+			}
+		}
+		for _, candidates := range [][]Expression{fitting, others} {
+			for _, i := range g.Rand.Perm(len(candidates)) {
+				if g.generate(text, candidates[i], depth) {
+					return true
+				}
+			}
+		}
+		return false
+	case Repetition:
+		count := e.Min
+		if depth+g.minDepth(e.Expression) <= g.MaxDepth {
+			most := e.Max
+			if most == -1 {
+				most = e.Min + 3
+			}
+			count += g.Rand.Intn(most - e.Min + 1)
+		}
+		var items strings.Builder
+		for i := 0; i < count; i++ {
+			if !g.generate(&items, e.Expression, depth) && i < e.Min {
+				return false
+			}
+		}
+		text.WriteString(items.String())
+	}
+	return true
+}
+
+func (g *Generator) generateName(text *strings.Builder, name string, depth int) bool {
+	if terminal := g.Terminals[name]; terminal != nil {
+		text.WriteString(terminal(g.Rand))
+		return true
+	}
+	check := g.Checks[name]
+	for i := 0; i < attempts; i++ {
+		var production strings.Builder
+		if !g.generate(&production, g.Grammar[name], depth+1) {
+			continue
+		}
+		if check == nil || check(production.String()) {
+			text.WriteString(production.String())
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) pickChar(class Class) (rune, bool) {
+	if !class.Negated {
+		size := 0
+		for _, r := range class.Ranges {
+			size += int(r[1]-r[0]) + 1
+		}
+		i := rune(g.Rand.Intn(size))
+		for _, r := range class.Ranges {
+			if i <= r[1]-r[0] {
+				return r[0] + i, true
+			}
+			i -= r[1] - r[0] + 1
+		}
+	}
+	var chars []rune
+	for _, char := range g.Universe {
+		if class.Contains(char) {
+			chars = append(chars, char)
+		}
+	}
+	if len(chars) == 0 {
+		return 0, false
+	}
+	return chars[g.Rand.Intn(len(chars))], true
+}
+
+func (g *Generator) minDepth(expression Expression) int {
+	return minDepth(g.minDepths, expression)
+}
+
+// unreachable is the depth of productions that never end.
+const unreachable = 1 << 30
+
+// minDepths returns, for every production, how deeply productions nest at
+// least in its shortest sentences.
+func (grammar Grammar) minDepths() map[string]int {
+	depths := make(map[string]int)
+	for name := range grammar {
+		depths[name] = unreachable
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, expression := range grammar {
+			if depth := minDepth(depths, expression); depth < depths[name] {
+				depths[name] = depth
+				changed = true
+			}
+		}
+	}
+	return depths
+}
+
+func minDepth(depths map[string]int, expression Expression) int {
+	switch e := expression.(type) {
+	case Name:
+		return min(depths[string(e)]+1, unreachable)
+	case Sequence:
+		depth := 0
+		for _, item := range e {
+			depth = max(depth, minDepth(depths, item))
+		}
+		return depth
+	case Alternatives:
+		depth := unreachable
+		for _, alt := range e {
+			depth = min(depth, minDepth(depths, alt))
+		}
+		return depth
+	case Repetition:
+		if e.Min == 0 {
+			return 0
+		}
+		return minDepth(depths, e.Expression)
+	}
+	return 0
+}
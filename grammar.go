@@ -0,0 +1,70 @@
+package main
+
+import (
+	_ "embed"
+	"maps"
+	"math/rand"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/caltuntas/regex-poc/ebnf"
+)
+
+// grammarText is the grammar of the default syntax, which the parser is kept
+// in line with.
+//
+//go:embed grammar.ebnf
+var grammarText string
+
+// maxRandomRepeat bounds the counts of the {m,n} repetitions in random
+// patterns, so that they compile into small automata.
+const maxRandomRepeat = 3
+
+// unicodeNames are the names accepted in \p{Name}, in a stable order.
+var unicodeNames = append(slices.Sorted(maps.Keys(unicode.Categories)), slices.Sorted(maps.Keys(unicode.Scripts))...)
+
+// Grammar returns the grammar of the default syntax read from grammar.ebnf.
+func Grammar() (ebnf.Grammar, error) {
+	return ebnf.Parse(grammarText)
+}
+
+// RandomPattern returns a random pattern of grammar whose productions nest at
+// most depth deep. Besides being a sentence of the grammar, it satisfies the
+// conditions listed at the top of grammar.ebnf, so Parse accepts it.
+func RandomPattern(grammar ebnf.Grammar, r *rand.Rand, depth int) (string, error) {
+	groups := 0
+	names := make(map[string]bool)
+	g := ebnf.NewGenerator(grammar, r, depth)
+	g.Checks = map[string]func(text string) bool{
+		"CaptureOpen": func(text string) bool {
+			groups++
+			return true
+		},
+		"Backreference": func(text string) bool {
+			return int(text[1]-'0') <= groups
+		},
+		"GroupName": func(text string) bool {
+			if names[text] {
+				return false
+			}
+			names[text] = true
+			return true
+		},
+		"Range": func(text string) bool {
+			from, _ := utf8.DecodeRuneInString(text)
+			to, _ := utf8.DecodeLastRuneInString(text)
+			return from <= to
+		},
+		"Repeat": func(text string) bool {
+			min, max, ok := parseRepeat(text)
+			return ok && min <= maxRandomRepeat && max <= maxRandomRepeat
+		},
+	}
+	g.Terminals = map[string]func(r *rand.Rand) string{
+		"UnicodeName": func(r *rand.Rand) string {
+			return unicodeNames[r.Intn(len(unicodeNames))]
+		},
+	}
+	return g.Generate("Regex")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// TestGrammarPatternsParse checks that the parser accepts every pattern
+// generated from grammar.ebnf.
+func TestGrammarPatternsParse(t *testing.T) {
+	grammar, err := Grammar()
+	if err != nil {
+		t.Fatalf("Grammar failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for depth := 3; depth <= 15; depth++ {
+		for i := 0; i < 100; i++ {
+			pattern, err := RandomPattern(grammar, r, depth)
+			if err != nil {
+				t.Fatalf("RandomPattern at depth %d failed: %v", depth, err)
+			}
+			if _, err := Parse(pattern); err != nil {
+				t.Errorf("Parse(%q) failed: %v", pattern, err)
+			}
+		}
+	}
+}
+
+// TestGrammarPatternsEnginesAgree checks that the automata and the
+// backtracker find the same matches for generated patterns, on inputs made of
+// the characters the patterns use.
+func TestGrammarPatternsEnginesAgree(t *testing.T) {
+	grammar, err := Grammar()
+	if err != nil {
+		t.Fatalf("Grammar failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		pattern, err := RandomPattern(grammar, r, 3+i%8)
+		if err != nil {
+			t.Fatalf("RandomPattern failed: %v", err)
+		}
+		ast := mustParse(t, pattern)
+		nfa, err := Compile(ast)
+		if errors.Is(err, ErrNotSupported) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %v", pattern, err)
+		}
+		chars := append([]rune(pattern), 'a', 'A', '\n', ' ', '\u00a0')
+		for j := 0; j < 5; j++ {
+			input := make([]rune, r.Intn(5))
+			for k := range input {
+				input[k] = chars[r.Intn(len(chars))]
+			}
+			if Match(nfa, string(input)) != MatchBacktrack(ast, string(input)) {
+				t.Errorf("Pattern = %s, Match(%q) = %v, MatchBacktrack disagrees", pattern, string(input), Match(nfa, string(input)))
+			}
+			if got, backtrack := FindSubmatch(nfa, string(input)), FindBacktrackSubmatch(ast, string(input)); !slices.Equal(got, backtrack) {
+				t.Errorf("Pattern = %s, FindSubmatch(%q) = %v, FindBacktrackSubmatch = %v", pattern, string(input), got, backtrack)
+			}
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// jsonNode is the JSON form of every node: Type tells which node it is and
+// only the fields of that node are set. Literal characters and range bounds
+// are written as strings to keep the output readable.
+type jsonNode struct {
+	Type         string      `json:"type"`
+	Value        string      `json:"value,omitempty"`
+	From         string      `json:"from,omitempty"`
+	To           string      `json:"to,omitempty"`
+	FoldCase     bool        `json:"foldCase,omitempty"`
+	Negated      bool        `json:"negated,omitempty"`
+	Behind       bool        `json:"behind,omitempty"`
+	Lazy         bool        `json:"lazy,omitempty"`
+	Possessive   bool        `json:"possessive,omitempty"`
+	Min          int         `json:"min,omitempty"`
+	Max          int         `json:"max,omitempty"`
+	Index        int         `json:"index,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	Child        *jsonNode   `json:"child,omitempty"`
+	Children     []*jsonNode `json:"children,omitempty"`
+	Alternatives []*jsonNode `json:"alternatives,omitempty"`
+	Chars        []*jsonNode `json:"chars,omitempty"`
+}
+
+// UnmarshalNode reads back a tree written by json.Marshal, whatever its root
+// node is. The tree is checked to be one both engines can run: every
+// backreference must refer to a group of the tree.
+func UnmarshalNode(data []byte) (Node, error) {
+	var j *jsonNode
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	node, err := decodeNode(j)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBackreferences(node, len(SubexpNames(node))-1); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func marshalNode(node Node) ([]byte, error) {
+	j, err := encodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// unmarshalNode reads data into target, which must be a node of the type
+// data describes.
+func unmarshalNode(data []byte, target Node) error {
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		return err
+	}
+	if reflect.TypeOf(node) != reflect.TypeOf(target) {
+		return fmt.Errorf("cannot unmarshal %T into %T", node, target)
+	}
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(node).Elem())
+	return nil
+}
+
+func encodeNode(node Node) (*jsonNode, error) {
+	var err error
+	var j *jsonNode
+	switch n := node.(type) {
+	case nil:
+		return nil, nil
+	case *SequenceNode:
+		j = &jsonNode{Type: "sequence"}
+		j.Children, err = encodeNodes(n.Children)
+	case *AlternationNode:
+		j = &jsonNode{Type: "alternation"}
+		j.Alternatives, err = encodeNodes(n.Alternatives)
+	case *LiteralNode:
+		j = &jsonNode{Type: "literal", Value: string(n.Value), FoldCase: n.FoldCase}
+	case *MetaCharacterNode:
+		j = &jsonNode{Type: "meta", Value: n.Value, FoldCase: n.FoldCase}
+	case *RangeNode:
+		j = &jsonNode{Type: "range", From: string(n.From), To: string(n.To), FoldCase: n.FoldCase}
+	case *CharList:
+		j = &jsonNode{Type: "charList", Negated: n.Negated}
+		for _, char := range n.Chars {
+			var c *jsonNode
+			if c, err = encodeNode(char); err != nil {
+				break
+			}
+			j.Chars = append(j.Chars, c)
+		}
+	case *AssertionNode:
+		j = &jsonNode{Type: "assertion", Value: n.Value}
+	case *BackreferenceNode:
+		j = &jsonNode{Type: "backreference", Index: n.Index, FoldCase: n.FoldCase}
+	case *StarNode:
+		j = &jsonNode{Type: "star", Lazy: n.Lazy, Possessive: n.Possessive}
+		j.Child, err = encodeNode(n.Child)
+	case *PlusNode:
+		j = &jsonNode{Type: "plus", Lazy: n.Lazy, Possessive: n.Possessive}
+		j.Child, err = encodeNode(n.Child)
+	case *QuestionNode:
+		j = &jsonNode{Type: "question", Lazy: n.Lazy, Possessive: n.Possessive}
+		j.Child, err = encodeNode(n.Child)
+	case *RepeatNode:
+		j = &jsonNode{Type: "repeat", Min: n.Min, Max: n.Max, Lazy: n.Lazy, Possessive: n.Possessive}
+		j.Child, err = encodeNode(n.Child)
+	case *GroupNode:
+		j = &jsonNode{Type: "group", Index: n.Index, Name: n.Name}
+		j.Child, err = encodeNode(n.Child)
+	case *AtomicNode:
+		j = &jsonNode{Type: "atomic"}
+		j.Child, err = encodeNode(n.Child)
+	case *LookaroundNode:
+		j = &jsonNode{Type: "lookaround", Behind: n.Behind, Negated: n.Negated}
+		j.Child, err = encodeNode(n.Child)
+	default:
+		return nil, fmt.Errorf("cannot marshal node type %T", node)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func encodeNodes(nodes []Node) ([]*jsonNode, error) {
+	var encoded []*jsonNode
+	for _, node := range nodes {
+		j, err := encodeNode(node)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, j)
+	}
+	return encoded, nil
+}
+
+func decodeNode(j *jsonNode) (Node, error) {
+	if j == nil {
+		return nil, fmt.Errorf("missing node")
+	}
+	switch j.Type {
+	case "sequence":
+		children, err := decodeNodes(j.Children)
+		if err != nil {
+			return nil, err
+		}
+		return &SequenceNode{Children: children}, nil
+	case "alternation":
+		if len(j.Alternatives) == 0 {
+			return nil, fmt.Errorf("alternation node without alternatives")
+		}
+		alternatives, err := decodeNodes(j.Alternatives)
+		if err != nil {
+			return nil, err
+		}
+		return &AlternationNode{Alternatives: alternatives}, nil
+	case "literal":
+		value, err := decodeChar(j.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &LiteralNode{Value: value, FoldCase: j.FoldCase}, nil
+	case "meta":
+		if !isMetaValue(j.Value) {
+			return nil, fmt.Errorf("unknown meta character %q", j.Value)
+		}
+		return &MetaCharacterNode{Value: j.Value, FoldCase: j.FoldCase}, nil
+	case "range":
+		from, err := decodeChar(j.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := decodeChar(j.To)
+		if err != nil {
+			return nil, err
+		}
+		return &RangeNode{From: from, To: to, FoldCase: j.FoldCase}, nil
+	case "charList":
+		if len(j.Chars) == 0 {
+			return nil, fmt.Errorf("charList node without chars")
+		}
+		chars, err := decodeNodes(j.Chars)
+		if err != nil {
+			return nil, err
+		}
+		n := &CharList{Negated: j.Negated}
+		for _, char := range chars {
+			c, ok := char.(CharacterNode)
+			if !ok {
+				return nil, fmt.Errorf("%T cannot be part of a charList", char)
+			}
+			n.Chars = append(n.Chars, c)
+		}
+		return n, nil
+	case "assertion":
+		switch j.Value {
+		case CARET, DOLLAR, BEGIN_LINE, END_LINE, BEGIN_TEXT, END_TEXT, WORD_BOUNDARY, NON_WORD_BOUNDARY:
+			return &AssertionNode{Value: j.Value}, nil
+		}
+		return nil, fmt.Errorf("unknown assertion %q", j.Value)
+	case "backreference":
+		return &BackreferenceNode{Index: j.Index, FoldCase: j.FoldCase}, nil
+	case "star", "plus", "question", "repeat", "group", "atomic", "lookaround":
+	default:
+		return nil, fmt.Errorf("unknown node type %q", j.Type)
+	}
+
+	if j.Child == nil {
+		return nil, fmt.Errorf("%s node without a child", j.Type)
+	}
+	child, err := decodeNode(j.Child)
+	if err != nil {
+		return nil, err
+	}
+	switch j.Type {
+	case "star":
+		return &StarNode{Child: child, Lazy: j.Lazy, Possessive: j.Possessive}, nil
+	case "plus":
+		return &PlusNode{Child: child, Lazy: j.Lazy, Possessive: j.Possessive}, nil
+	case "question":
+		return &QuestionNode{Child: child, Lazy: j.Lazy, Possessive: j.Possessive}, nil
+	case "repeat":
+		if j.Min < 0 || j.Max < -1 || j.Max != -1 && j.Max < j.Min {
+			return nil, fmt.Errorf("invalid repeat bounds min %d, max %d", j.Min, j.Max)
+		}
+		return &RepeatNode{Child: child, Min: j.Min, Max: j.Max, Lazy: j.Lazy, Possessive: j.Possessive}, nil
+	case "group":
+		if j.Index < 0 {
+			return nil, fmt.Errorf("invalid group index %d", j.Index)
+		}
+		return &GroupNode{Child: child, Index: j.Index, Name: j.Name}, nil
+	case "atomic":
+		return &AtomicNode{Child: child}, nil
+	case "lookaround":
+		return &LookaroundNode{Child: child, Behind: j.Behind, Negated: j.Negated}, nil
+	}
+	return nil, fmt.Errorf("unknown node type %q", j.Type)
+}
+
+func decodeNodes(encoded []*jsonNode) ([]Node, error) {
+	var nodes []Node
+	for _, j := range encoded {
+		node, err := decodeNode(j)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// isMetaValue reports whether value is one of the classes a MetaCharacterNode
+// stands for.
+func isMetaValue(value string) bool {
+	switch value {
+	case DOT, ANY_CHAR, WHITESPACE, NONWHITESPACE, DIGIT, NONDIGIT, WORD, NONWORD:
+		return true
+	}
+	_, ok := namedClass(value)
+	return ok
+}
+
+// checkBackreferences returns an error for the first backreference under node
+// whose index is not between 1 and groups, the highest group index.
+func checkBackreferences(node Node, groups int) error {
+	var children []Node
+	switch n := node.(type) {
+	case *BackreferenceNode:
+		if n.Index < 1 || n.Index > groups {
+			return fmt.Errorf("backreference %s to a group that does not exist", n.String())
+		}
+	case *SequenceNode:
+		children = n.Children
+	case *AlternationNode:
+		children = n.Alternatives
+	case *StarNode:
+		children = []Node{n.Child}
+	case *PlusNode:
+		children = []Node{n.Child}
+	case *QuestionNode:
+		children = []Node{n.Child}
+	case *RepeatNode:
+		children = []Node{n.Child}
+	case *GroupNode:
+		children = []Node{n.Child}
+	case *AtomicNode:
+		children = []Node{n.Child}
+	case *LookaroundNode:
+		children = []Node{n.Child}
+	}
+	for _, child := range children {
+		if err := checkBackreferences(child, groups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeChar returns the single character value holds.
+func decodeChar(value string) (rune, error) {
+	char, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) {
+		return 0, fmt.Errorf("%q is not a single character", value)
+	}
+	return char, nil
+}
+
+func (n *SequenceNode) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *AlternationNode) MarshalJSON() ([]byte, error)   { return marshalNode(n) }
+func (n *LiteralNode) MarshalJSON() ([]byte, error)       { return marshalNode(n) }
+func (n *MetaCharacterNode) MarshalJSON() ([]byte, error) { return marshalNode(n) }
+func (n *RangeNode) MarshalJSON() ([]byte, error)         { return marshalNode(n) }
+func (n *CharList) MarshalJSON() ([]byte, error)          { return marshalNode(n) }
+func (n *AssertionNode) MarshalJSON() ([]byte, error)     { return marshalNode(n) }
+func (n *BackreferenceNode) MarshalJSON() ([]byte, error) { return marshalNode(n) }
+func (n *StarNode) MarshalJSON() ([]byte, error)          { return marshalNode(n) }
+func (n *PlusNode) MarshalJSON() ([]byte, error)          { return marshalNode(n) }
+func (n *QuestionNode) MarshalJSON() ([]byte, error)      { return marshalNode(n) }
+func (n *RepeatNode) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *GroupNode) MarshalJSON() ([]byte, error)         { return marshalNode(n) }
+func (n *AtomicNode) MarshalJSON() ([]byte, error)        { return marshalNode(n) }
+func (n *LookaroundNode) MarshalJSON() ([]byte, error)    { return marshalNode(n) }
+
+func (n *SequenceNode) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *AlternationNode) UnmarshalJSON(data []byte) error   { return unmarshalNode(data, n) }
+func (n *LiteralNode) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, n) }
+func (n *MetaCharacterNode) UnmarshalJSON(data []byte) error { return unmarshalNode(data, n) }
+func (n *RangeNode) UnmarshalJSON(data []byte) error         { return unmarshalNode(data, n) }
+func (n *CharList) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, n) }
+func (n *AssertionNode) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, n) }
+func (n *BackreferenceNode) UnmarshalJSON(data []byte) error { return unmarshalNode(data, n) }
+func (n *StarNode) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, n) }
+func (n *PlusNode) UnmarshalJSON(data []byte) error          { return unmarshalNode(data, n) }
+func (n *QuestionNode) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, n) }
+func (n *RepeatNode) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *GroupNode) UnmarshalJSON(data []byte) error         { return unmarshalNode(data, n) }
+func (n *AtomicNode) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, n) }
+func (n *LookaroundNode) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, n) }
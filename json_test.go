@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	ast, err := Parse("(?i)a[^0-9\\d]*?|(?P<x>.)\\1{2,}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"alternation","alternatives":[` +
+		`{"type":"sequence","children":[` +
+		`{"type":"literal","value":"a","foldCase":true},` +
+		`{"type":"star","lazy":true,"child":{"type":"charList","negated":true,"chars":[` +
+		`{"type":"range","from":"0","to":"9","foldCase":true},{"type":"meta","value":"\\d"}]}}]},` +
+		`{"type":"sequence","children":[` +
+		`{"type":"group","index":1,"name":"x","child":{"type":"sequence","children":[{"type":"meta","value":"."}]}},` +
+		`{"type":"repeat","min":2,"max":-1,"child":{"type":"backreference","foldCase":true,"index":1}}]}]}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestUnmarshalNodeRoundTrip(t *testing.T) {
+	nodes := []Node{
+		b.Seq(),
+		b.Seq(b.Lit('a'), b.FoldLit('é'), b.Lit(0), b.Meta(ANY_CHAR), b.Assert(BEGIN_LINE)),
+		b.Alt(b.Lit('a'), b.Seq(), b.Star(b.Seq(b.Lit('b'), b.Lit('c')))),
+		b.Seq(b.Lazy(b.Plus(b.Lit('a'))), b.Possessive(b.Question(b.Lit('b'))), b.Repeat(b.Lit('c'), 0, 3)),
+		b.Seq(b.List(b.Range('a', 'z'), b.FoldRange('0', '9'), b.Meta("[:alpha:]")), b.NotList(b.Lit(']'))),
+		b.Seq(b.List(b.FoldMeta("[:upper:]")), b.FoldMeta("\\P{Greek}")),
+		b.Seq(b.Named(1, "year", b.Seq(b.Meta(DIGIT))), b.Capture(2, b.Lit('x')), b.Group(b.Backref(1))),
+		b.Seq(b.Atomic(b.Lit('a')), b.Lookaround(b.Lit('b'), true, true), b.Lookaround(b.Lit('c'), false, false)),
+	}
+	for _, node := range nodes {
+		data, err := json.Marshal(node)
+		if err != nil {
+			t.Fatalf("json.Marshal(%s) failed: %v", Pattern(node), err)
+		}
+		got, err := UnmarshalNode(data)
+		if err != nil {
+			t.Fatalf("UnmarshalNode(%s) failed: %v", data, err)
+		}
+		if !reflect.DeepEqual(got, node) {
+			t.Errorf("UnmarshalNode(%s) = %s, want %s", data, Pattern(got), Pattern(node))
+		}
+	}
+
+	grammar, err := Grammar()
+	if err != nil {
+		t.Fatalf("Grammar failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		pattern, err := RandomPattern(grammar, r, 10)
+		if err != nil {
+			t.Fatalf("RandomPattern failed: %v", err)
+		}
+		ast, err := Parse(pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", pattern, err)
+		}
+		data, err := json.Marshal(ast)
+		if err != nil {
+			t.Fatalf("json.Marshal(Parse(%q)) failed: %v", pattern, err)
+		}
+		got, err := UnmarshalNode(data)
+		if err != nil {
+			t.Fatalf("UnmarshalNode(%s) failed: %v", data, err)
+		}
+		if !reflect.DeepEqual(got, ast) {
+			t.Fatalf("UnmarshalNode(json.Marshal(Parse(%q))) = %s, a different tree", pattern, Pattern(got))
+		}
+	}
+}
+
+func TestUnmarshalJSONInto(t *testing.T) {
+	var star StarNode
+	if err := json.Unmarshal([]byte(`{"type":"star","child":{"type":"literal","value":"a"}}`), &star); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&star, b.Star(b.Lit('a'))) {
+		t.Errorf("json.Unmarshal() = %s, want a*", Pattern(&star))
+	}
+
+	var saved struct {
+		Pattern string
+		Ast     *SequenceNode
+	}
+	data := `{"Pattern":"ab","Ast":{"type":"sequence","children":[{"type":"literal","value":"a"},{"type":"literal","value":"b"}]}}`
+	if err := json.Unmarshal([]byte(data), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := Pattern(saved.Ast); got != saved.Pattern {
+		t.Errorf("json.Unmarshal() = %s, want %s", got, saved.Pattern)
+	}
+}
+
+func TestUnmarshalNodeErrors(t *testing.T) {
+	cases := map[string]string{
+		`{"type":"circle"}`:                   `unknown node type "circle"`,
+		`{"type":"literal","value":"ab"}`:     `"ab" is not a single character`,
+		`{"type":"literal"}`:                  `"" is not a single character`,
+		`{"type":"range","from":"a","to":""}`: `"" is not a single character`,
+		`{"type":"charList","chars":[{"type":"star","child":{"type":"sequence"}}]}`: `*main.StarNode cannot be part of a charList`,
+		`{"type":"star","child":{"type":"sequence","children":[{}]}}`:               `unknown node type ""`,
+		`{"type":"star"}`:                                                  `star node without a child`,
+		`{"type":"group","index":1,"child":null}`:                          `group node without a child`,
+		`{"type":"sequence","children":[null]}`:                            `missing node`,
+		`{"type":"alternation","alternatives":[{"type":"sequence"},null]}`: `missing node`,
+		`{"type":"repeat","min":3,"max":2,"child":{"type":"sequence"}}`:    `invalid repeat bounds min 3, max 2`,
+		`{"type":"repeat","min":-1,"child":{"type":"sequence"}}`:           `invalid repeat bounds min -1, max 0`,
+		`{"type":"alternation"}`:                                           `alternation node without alternatives`,
+		`{"type":"charList","chars":[]}`:                                   `charList node without chars`,
+		`{"type":"group","index":-1,"child":{"type":"sequence"}}`:          `invalid group index -1`,
+		`{"type":"meta","value":"\\q"}`:                                    `unknown meta character "\\q"`,
+		`{"type":"meta","value":"[:word:]"}`:                               `unknown meta character "[:word:]"`,
+		`{"type":"assertion","value":"\\Z"}`:                               `unknown assertion "\\Z"`,
+		`{"type":"backreference","index":1}`:                               `backreference \1 to a group that does not exist`,
+		`{"type":"sequence","children":[{"type":"group","index":1,"child":{"type":"sequence"}},{"type":"backreference","index":2}]}`: `backreference \2 to a group that does not exist`,
+		`{"type":"star","child":{"type":"backreference"}}`:                                                                           `backreference \0 to a group that does not exist`,
+		`null`: `missing node`,
+		`[]`:   `cannot unmarshal array`,
+	}
+	for data, want := range cases {
+		_, err := UnmarshalNode([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("UnmarshalNode(%s) error = %v, want %s", data, err, want)
+		}
+	}
+
+	var plus PlusNode
+	err := json.Unmarshal([]byte(`{"type":"star","child":{"type":"literal","value":"a"}}`), &plus)
+	if err == nil || !strings.Contains(err.Error(), "cannot unmarshal *main.StarNode into *main.PlusNode") {
+		t.Errorf("json.Unmarshal() error = %v, want a type mismatch", err)
+	}
+}
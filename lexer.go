@@ -1,46 +1,119 @@
 package main
 
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 type TokenType string
 
 type Token struct {
-	Type  TokenType
-	Value string
+	Type     TokenType
+	Value    string
+	Position int
+}
+
+// Rune returns the first character of the token's value.
+func (t Token) Rune() rune {
+	char, _ := utf8.DecodeRuneInString(t.Value)
+	return char
 }
 
 const (
-	STAR     = "*"
-	DOT      = "."
-	LBRACKET = "["
-	RBRACKET = "]"
-	ESCAPE   = "\\"
-	EOF      = "EOF"
+	STAR       = "*"
+	DOT        = "."
+	LBRACKET   = "["
+	RBRACKET   = "]"
+	ESCAPE     = "\\"
+	PIPE       = "|"
+	LPAREN     = "("
+	RPAREN     = ")"
+	PLUS       = "+"
+	QUESTION   = "?"
+	REPEAT     = "REPEAT"
+	POSIXCLASS = "POSIXCLASS"
+	CARET      = "^"
+	DOLLAR     = "$"
+	EOF        = "EOF"
 )
 
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
-	ch           byte
+	ch           rune
+	// escaped is set after an ESCAPE token so the next character is always
+	// returned as a LITERAL, whatever its meaning would be on its own
+	escaped bool
+	// quoted is set between \Q and \E, where every character is a LITERAL
+	quoted bool
+	flags  Flags
+	// bracket tracks where we are in a bracket expression, inside which the
+	// operators lose their meaning
+	bracket bracketState
 }
 
+type bracketState int
+
+const (
+	outsideBracket bracketState = iota
+	bracketOpened
+	bracketNegated
+	insideBracket
+)
+
 func New(pattern string) *Lexer {
 	l := &Lexer{input: pattern}
 	return l
 }
 
-func (l *Lexer) PeekChar() byte {
+func (l *Lexer) PeekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 func (l *Lexer) NextToken() Token {
 	var token Token
 	l.readChar()
-	if l.ch == 0 {
+	if l.flags&FreeSpacing != 0 {
+		l.skipFreeSpacing()
+	}
+	if l.isQuoteDelimiter() {
+		// \Q and \E only switch quoting on and off, they are not tokens
+		l.quoted = l.PeekChar() == 'Q'
+		l.readChar()
+		return l.NextToken()
+	}
+	token.Position = l.position
+	if l.position >= len(l.input) {
 		token.Type = EOF
 		token.Value = ""
+	} else if l.escaped || l.quoted {
+		token.Type = LITERAL
+		token.Value = string(l.ch)
+		if l.bracket != outsideBracket {
+			l.bracket = insideBracket
+		}
+	} else if l.bracket != outsideBracket {
+		l.readBracketToken(&token)
+	} else if l.flags&BRE != 0 && l.ch == '\\' && l.PeekChar() == '(' {
+		l.readChar()
+		token.Type = LPAREN
+		token.Value = "\\("
+	} else if l.flags&BRE != 0 && l.ch == '\\' && l.PeekChar() == ')' {
+		l.readChar()
+		token.Type = RPAREN
+		token.Value = "\\)"
+	} else if l.flags&BRE != 0 && l.ch == '\\' && l.PeekChar() == '{' && l.isRepeat("\\{", "\\}") {
+		token.Type = REPEAT
+		token.Value = l.readRepeat("\\{", "\\}")
+	} else if l.flags&BRE != 0 && strings.ContainsRune("(){}+?|", l.ch) {
+		token.Type = LITERAL
+		token.Value = string(l.ch)
 	} else if l.ch == '.' {
 		token.Type = DOT
 		token.Value = string(l.ch)
@@ -50,25 +123,187 @@ func (l *Lexer) NextToken() Token {
 	} else if l.ch == '[' {
 		token.Type = LBRACKET
 		token.Value = string(l.ch)
+		l.bracket = bracketOpened
 	} else if l.ch == ']' {
 		token.Type = RBRACKET
 		token.Value = string(l.ch)
 	} else if l.ch == '\\' {
 		token.Type = ESCAPE
 		token.Value = string(l.ch)
+	} else if l.ch == '+' {
+		token.Type = PLUS
+		token.Value = string(l.ch)
+	} else if l.ch == '?' {
+		token.Type = QUESTION
+		token.Value = string(l.ch)
+	} else if l.ch == '{' && l.isRepeat("{", "}") {
+		token.Type = REPEAT
+		token.Value = l.readRepeat("{", "}")
+	} else if l.ch == '^' {
+		token.Type = CARET
+		token.Value = string(l.ch)
+	} else if l.ch == '$' {
+		token.Type = DOLLAR
+		token.Value = string(l.ch)
+	} else if l.ch == '|' {
+		token.Type = PIPE
+		token.Value = string(l.ch)
+	} else if l.ch == '(' {
+		token.Type = LPAREN
+		token.Value = string(l.ch)
+	} else if l.ch == ')' {
+		token.Type = RPAREN
+		token.Value = string(l.ch)
 	} else {
 		token.Type = LITERAL
 		token.Value = string(l.ch)
 	}
+	l.escaped = token.Type == ESCAPE
 	return token
 }
 
+// isQuoteDelimiter reports whether the current character starts the \Q that
+// opens a quoted span or the \E that closes it. Only the default syntax has
+// quoted spans.
+func (l *Lexer) isQuoteDelimiter() bool {
+	if l.ch != '\\' || l.escaped || l.flags&(BRE|ERE) != 0 {
+		return false
+	}
+	if l.quoted {
+		return l.PeekChar() == 'E'
+	}
+	return l.PeekChar() == 'Q'
+}
+
+// skipFreeSpacing skips the whitespace and comments at the current position.
+// Escaped characters and those in bracket expressions and quoted spans are
+// never skipped.
+func (l *Lexer) skipFreeSpacing() {
+	for !l.escaped && !l.quoted && l.bracket == outsideBracket {
+		if l.ch == '#' {
+			for l.position < len(l.input) && l.ch != '\n' {
+				l.readChar()
+			}
+		}
+		if l.position >= len(l.input) || !unicode.IsSpace(l.ch) {
+			return
+		}
+		l.readChar()
+	}
+}
+
+// Rewind moves the lexer back to offset, which must not be inside a bracket
+// expression or a quoted span, so that the input from there is lexed again.
+func (l *Lexer) Rewind(offset int) {
+	l.readPosition = offset
+	l.escaped = false
+	l.quoted = false
+	l.bracket = outsideBracket
+}
+
 func (l *Lexer) readChar() {
+	size := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += size
+}
+
+// readBracketToken lexes a character inside a bracket expression. In the POSIX
+// syntaxes a leading ']' is a literal and so are backslashes and dots.
+func (l *Lexer) readBracketToken(token *Token) {
+	posix := l.flags&(BRE|ERE) != 0
+	state := l.bracket
+	l.bracket = insideBracket
+	token.Value = string(l.ch)
+	switch {
+	case l.ch == '^' && state == bracketOpened:
+		token.Type = CARET
+		l.bracket = bracketNegated
+	case l.ch == ']' && (state == insideBracket || !posix):
+		token.Type = RBRACKET
+		l.bracket = outsideBracket
+	case l.ch == '[' && l.PeekChar() == ':' && l.isPosixClass():
+		token.Type = POSIXCLASS
+		token.Value = l.readPosixClass()
+	case l.ch == '\\' && !posix:
+		token.Type = ESCAPE
+	case l.ch == '.' && !posix:
+		token.Type = DOT
+	default:
+		token.Type = LITERAL
+	}
+}
+
+func (l *Lexer) isPosixClass() bool {
+	return l.scanPosixClass() != ""
+}
+
+func (l *Lexer) readPosixClass() string {
+	value := l.scanPosixClass()
+	l.readPosition = l.position + len(value)
+	return value
+}
+
+// scanPosixClass returns the named class such as "[:alpha:]" at the current
+// position, or an empty string when there is none.
+func (l *Lexer) scanPosixClass() string {
+	i := l.position + 2
+	for i < len(l.input) && ('a' <= l.input[i] && l.input[i] <= 'z') {
+		i++
+	}
+	if i == l.position+2 || !strings.HasPrefix(l.input[i:], ":]") {
+		return ""
+	}
+	return l.input[l.position : i+2]
+}
+
+func (l *Lexer) isRepeat(opening, closing string) bool {
+	value, _ := l.scanRepeat(opening, closing)
+	return value != ""
+}
+
+// readRepeat consumes the counted repetition at the current position and
+// returns it in the "{m,n}" form whatever its delimiters were.
+func (l *Lexer) readRepeat(opening, closing string) string {
+	value, end := l.scanRepeat(opening, closing)
+	l.readPosition = end
+	return value
+}
+
+// scanRepeat looks for a counted repetition such as "{2}", "{2,}" or "{2,5}"
+// delimited by opening and closing at the current position. It returns the
+// repetition and the offset just after it, or an empty string when the
+// opening delimiter does not start one.
+func (l *Lexer) scanRepeat(opening, closing string) (string, int) {
+	if !strings.HasPrefix(l.input[l.position:], opening) {
+		return "", 0
+	}
+	start := l.position + len(opening)
+	i := start
+	readDigits := func() int {
+		from := i
+		for i < len(l.input) && isDigit(l.input[i]) {
+			i++
+		}
+		return i - from
+	}
+	if readDigits() == 0 {
+		return "", 0
+	}
+	if i < len(l.input) && l.input[i] == ',' {
+		i++
+		readDigits()
+	}
+	if !strings.HasPrefix(l.input[i:], closing) {
+		return "", 0
+	}
+	return "{" + l.input[start:i] + "}", i + len(closing)
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
 }
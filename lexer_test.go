@@ -36,3 +36,249 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenGroups(t *testing.T) {
+	l := New("(ab)|c")
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{LPAREN, "("},
+		{LITERAL, "a"},
+		{LITERAL, "b"},
+		{RPAREN, ")"},
+		{PIPE, "|"},
+		{LITERAL, "c"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
+
+func TestNextTokenQuantifiers(t *testing.T) {
+	l := New("a+b?c{2}d{2,}e{2,5}{x}")
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{LITERAL, "a"},
+		{PLUS, "+"},
+		{LITERAL, "b"},
+		{QUESTION, "?"},
+		{LITERAL, "c"},
+		{REPEAT, "{2}"},
+		{LITERAL, "d"},
+		{REPEAT, "{2,}"},
+		{LITERAL, "e"},
+		{REPEAT, "{2,5}"},
+		{LITERAL, "{"},
+		{LITERAL, "x"},
+		{LITERAL, "}"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
+
+func TestNextTokenPosition(t *testing.T) {
+	l := New("a{2,3}[b]")
+	expected := []int{0, 1, 6, 7, 8, 9}
+	for i, position := range expected {
+		token := l.NextToken()
+		if token.Position != position {
+			t.Fatalf("test[%d], expected position %d for %q, got %d", i, position, token.Value, token.Position)
+		}
+	}
+}
+
+func TestNextTokenEscaped(t *testing.T) {
+	l := New("\\*\\{2}\\\\")
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{ESCAPE, "\\"},
+		{LITERAL, "*"},
+		{ESCAPE, "\\"},
+		{LITERAL, "{"},
+		{LITERAL, "2"},
+		{LITERAL, "}"},
+		{ESCAPE, "\\"},
+		{LITERAL, "\\"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	l := New("é[α-ω]*日")
+	tests := []struct {
+		expectedType     TokenType
+		expectedLiteral  string
+		expectedPosition int
+	}{
+		{LITERAL, "é", 0},
+		{LBRACKET, "[", 2},
+		{LITERAL, "α", 3},
+		{LITERAL, "-", 5},
+		{LITERAL, "ω", 6},
+		{RBRACKET, "]", 8},
+		{STAR, "*", 9},
+		{LITERAL, "日", 10},
+		{EOF, "", 13},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+		if token.Position != test.expectedPosition {
+			t.Fatalf("test[%d], expected position doesn't match. expected = %d, got = %d", i, test.expectedPosition, token.Position)
+		}
+	}
+}
+
+func TestNextTokenBasicSyntax(t *testing.T) {
+	l := New("\\(a+\\)\\{1,2\\}[]\\]")
+	l.flags = BRE
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{LPAREN, "\\("},
+		{LITERAL, "a"},
+		{LITERAL, "+"},
+		{RPAREN, "\\)"},
+		{REPEAT, "{1,2}"},
+		{LBRACKET, "["},
+		{LITERAL, "]"},
+		{LITERAL, "\\"},
+		{RBRACKET, "]"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
+
+func TestNextTokenPosixClass(t *testing.T) {
+	l := New("[^[:alpha:][:x]")
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{LBRACKET, "["},
+		{CARET, "^"},
+		{POSIXCLASS, "[:alpha:]"},
+		{LITERAL, "["},
+		{LITERAL, ":"},
+		{LITERAL, "x"},
+		{RBRACKET, "]"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
+
+func TestNextTokenQuoted(t *testing.T) {
+	l := New("a\\Q*[\\]\\E+\\Q)")
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{LITERAL, "a"},
+		{LITERAL, "*"},
+		{LITERAL, "["},
+		{LITERAL, "\\"},
+		{LITERAL, "]"},
+		{PLUS, "+"},
+		{LITERAL, ")"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
+
+func TestNextTokenFreeSpacing(t *testing.T) {
+	l := New("a b # comment *\n\t\\ [ #]+\\Q #\\E")
+	l.flags = FreeSpacing
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{LITERAL, "a"},
+		{LITERAL, "b"},
+		{ESCAPE, "\\"},
+		{LITERAL, " "},
+		{LBRACKET, "["},
+		{LITERAL, " "},
+		{LITERAL, "#"},
+		{RBRACKET, "]"},
+		{PLUS, "+"},
+		{LITERAL, " "},
+		{LITERAL, "#"},
+		{EOF, ""},
+	}
+
+	for i, test := range tests {
+		token := l.NextToken()
+		if token.Type != test.expectedType {
+			t.Fatalf("test[%d], expected type doesn't match. expected = %q, got = %q", i, test.expectedType, token.Type)
+		}
+		if token.Value != test.expectedLiteral {
+			t.Fatalf("test[%d], expected literal doesn't match. expected = %q, got = %q", i, test.expectedLiteral, token.Value)
+		}
+	}
+}
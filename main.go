@@ -1,15 +1,32 @@
 package main
 
-import "fmt"
-
-func lex(pattern string) {
-
-}
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+)
 
+// main prints random patterns of the default syntax generated from
+// grammar.ebnf, one per line.
 func main() {
-	pattern := "parent.*type"
-	lex(pattern)
-
+	count := flag.Int("n", 10, "number of patterns to print")
+	depth := flag.Int("depth", 12, "how deeply the grammar productions may nest")
+	seed := flag.Int64("seed", 1, "seed of the random choices")
+	flag.Parse()
 
-	fmt.Println("hello world")
+	grammar, err := Grammar()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r := rand.New(rand.NewSource(*seed))
+	for i := 0; i < *count; i++ {
+		pattern, err := RandomPattern(grammar, r, *depth)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(pattern)
+	}
 }
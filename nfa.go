@@ -16,6 +16,14 @@ const (
 type Nfa struct {
 	Start  *State
 	Accept *State
+	// names holds the group names of the pattern the NFA was compiled from
+	names []string
+}
+
+// SubexpNames returns the names of the capturing groups of the compiled
+// pattern, indexed by group number; see the function of the same name.
+func (n Nfa) SubexpNames() []string {
+	return n.names
 }
 
 type TransitionType int
@@ -23,16 +31,34 @@ type TransitionType int
 const (
 	Literal TransitionType = iota
 	Meta
+	Range
+	NegatedClass
+	Assert
+	// Save records the current offset in the capture slot named by its
+	// condition and, like Assert, consumes nothing.
+	Save
 )
 
 func (me TransitionType) String() string {
-	return [...]string{"Literal", "Meta"}[me]
+	return [...]string{"Literal", "Meta", "Range", "NegatedClass", "Assert", "Save"}[me]
 }
 
 type Transition struct {
 	Type  TransitionType
 	Condition string
 	State *State
+	// Items holds the members of a NegatedClass transition, which matches
+	// any character that none of them match.
+	Items []Transition
+	// FoldCase makes Literal and Range transitions, and Meta ones for named
+	// classes, ignore case.
+	FoldCase bool
+}
+
+// Consumes reports whether following t reads a character; Assert and Save
+// transitions are zero-width and are followed while computing closures instead.
+func (t Transition) Consumes() bool {
+	return t.Type != Assert && t.Type != Save
 }
 
 type State struct {
@@ -59,8 +85,17 @@ func (n *Nfa) NewState() *State {
 }
 
 func getTransitionType(str string) TransitionType {
-	if str == DOT || str == WHITESPACE {
+	switch str {
+	case DOT, ANY_CHAR, WHITESPACE, NONWHITESPACE, DIGIT, NONDIGIT, WORD, NONWORD:
 		return Meta
+	case CARET, DOLLAR, BEGIN_LINE, END_LINE, BEGIN_TEXT, END_TEXT, WORD_BOUNDARY, NON_WORD_BOUNDARY:
+		return Assert
+	}
+	if _, ok := namedClass(str); ok {
+		return Meta
+	}
+	if chars := []rune(str); len(chars) == 3 && chars[1] == '-' {
+		return Range
 	}
 	return Literal
 }
@@ -75,6 +110,28 @@ func (s *State) AddEpsilonTo(to *State) {
 	s.Epsilon = append(s.Epsilon, to)
 }
 
+// States returns every state reachable from the start state.
+func (n *Nfa) States() []*State {
+	var states []*State
+	seen := make(map[*State]bool)
+	var visit func(s *State)
+	visit = func(s *State) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		states = append(states, s)
+		for _, t := range s.Transitions {
+			visit(t.State)
+		}
+		for _, e := range s.Epsilon {
+			visit(e)
+		}
+	}
+	visit(n.Start)
+	return states
+}
+
 func (n *Nfa) NewAccept() *State {
 	accept := &State{}
 	n.Accept = accept
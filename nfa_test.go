@@ -114,12 +114,8 @@ func TestNFAStates(t *testing.T) {
 			),
 
 			`state1,state2,p
-			 state2,state3,ε
-			 state3,state4,a
-			 state4,state8,ε
-			 state2,state5,ε
-			 state5,state6,b
-			 state6,state8,ε`,
+			 state2,state3,a
+			 state2,state3,b`,
 		 },
 		{
 			nb.Meta(DOT),
@@ -133,21 +129,49 @@ func TestNFAStates(t *testing.T) {
 			),
 			`state1,state2,a
 			 state2,state3,ε
-			 state3,state4,ε
-			 state4,state5,b
-			 state5,state6,ε
-			 state6,state7,ε
-			 state7,state8,d
-			 state6,state3,ε
-			 state3,state9,ε
-			 state9,state10,c
-			 state10,state6,ε
-			 state2,state7,ε`,
+			 state3,state4,b
+			 state3,state4,c
+			 state4,state5,ε
+			 state4,state3,ε
+			 state2,state5,ε
+			 state5,state6,d`,
 		 },
+		{
+			nb.Alt(nb.Lit('a'), nb.Lit('b')),
+			`state1,state2,ε
+			 state2,state3,a
+			 state3,state6,ε
+			 state1,state4,ε
+			 state4,state5,b
+			 state5,state6,ε`,
+		},
+		{
+			nb.Group(nb.Seq(nb.Lit('a'), nb.Lit('b'))),
+			`state1,state2,a
+			 state2,state3,b`,
+		},
+		{
+			nb.List(nb.Range('a', 'z'), nb.Meta(WHITESPACE)),
+			`state1,state2,a-z
+			 state1,state2,\s`,
+		},
+		{
+			nb.Seq(
+				nb.Meta(NONWHITESPACE),
+				nb.Meta(DIGIT),
+				nb.Meta(WORD),
+			),
+			`state1,state2,\S
+			 state2,state3,\d
+			 state3,state4,\w`,
+		},
 	}
 
 	for _, tc := range cases {
-		nfa := Compile(tc.node)
+		nfa, err := Compile(tc.node)
+		if err != nil {
+			t.Fatal(err)
+		}
 		actualEncoding := nfa.Encode()
 		expectedNfa := CreateNfaFromString(tc.expected)
 		expectedEncoding := expectedNfa.Encode()
@@ -162,9 +186,12 @@ func TestEncode(t *testing.T) {
 		nb.Lit('p'),
 		nb.List(nb.Lit('a'), nb.Lit('b')),
 	)
-	nfa := Compile(ast)
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 	actualEncoding := nfa.Encode()
-	expectedEncoding := "(s-[Literal:p]->(s-[ε]->(s-[Literal:a]->(s-[ε]->)))(s-[ε]->(s-[Literal:b]->(s-[ε]-><back>))))"
+	expectedEncoding := "(s-[Literal:p]->(s-[Literal:a]->)(s-[Literal:b]-><back>))"
 	if actualEncoding != expectedEncoding {
 		t.Fatalf("NFA mismatch:\nGot:\n%s\nExpected:\n%s", actualEncoding, expectedEncoding)
 	}
@@ -175,15 +202,48 @@ func TestToDigraph(t *testing.T) {
 digraph {
 s1->s2 [label=ε]
 s2->s4 [label=a]
-s4->s6 [label=ε]
 s4->s2 [label=ε]
-s1->s6 [label=ε]
+s4->s8 [label=ε]
+s1->s8 [label=ε]
 }
 `
 	ast := nb.Star(nb.Lit('a'))
-	nfa := Compile(ast)
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 	actual := nfa.ToDigraph()
 	if strings.TrimSpace(actual) != strings.TrimSpace(expected) {
 		t.Fatalf("NFA mismatch:\nGot:\n%s\nExpected:\n%s", actual, expected)
 	}
 }
+
+func TestCompileRepeatLimit(t *testing.T) {
+	limit := MaxRepeatStates
+	defer func() { MaxRepeatStates = limit }()
+	MaxRepeatStates = 100
+
+	if _, err := Compile(nb.Repeat(nb.Lit('a'), 2, 40)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_, err := Compile(nb.Repeat(nb.Lit('a'), 2, 60))
+	if want := "repetition a{2,60} expands to more than 100 states"; err == nil || err.Error() != want {
+		t.Fatalf("Compile error = %v, want %s", err, want)
+	}
+	if _, err := Compile(nb.Repeat(nb.Lit('a'), 1<<62, -1)); err == nil {
+		t.Fatal("expected an error for a repetition whose state count overflows")
+	}
+}
+
+func TestEncodeNegatedClass(t *testing.T) {
+	ast := nb.NotList(nb.Range('a', 'z'), nb.Lit('_'))
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actualEncoding := nfa.Encode()
+	expectedEncoding := "(s-[NegatedClass:[^a-z_]]->)"
+	if actualEncoding != expectedEncoding {
+		t.Fatalf("NFA mismatch:\nGot:\n%s\nExpected:\n%s", actualEncoding, expectedEncoding)
+	}
+}
@@ -1,27 +1,177 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
 type Parser struct {
 	l            *Lexer
 	currentToken Token
 	nextToken    Token
+	errors       []*ParseError
+	flags        Flags
+	// groups counts the capturing groups opened so far
+	groups int
+	names  map[string]bool
+}
+
+// Flags select the syntax a pattern is written in; the zero value is the
+// Perl-like syntax the parser accepts by default.
+type Flags uint16
+
+const (
+	// BRE parses POSIX basic regular expressions, where \( \) and \{m,n\}
+	// are the operators, a leading * is a literal and ^ and $ only anchor at
+	// the ends of an expression.
+	BRE Flags = 1 << iota
+	// ERE reads POSIX extended regular expressions the way egrep does:
+	// backslashes are literal in bracket expressions and a leading ']' is
+	// part of the set, a backslash outside them only quotes the next
+	// character, \1 to \9 aside, and there are no (?...) groups, \Q...\E
+	// spans or lazy and possessive quantifiers. Quantifiers stack, so a+?
+	// is (a+)?, and one with nothing to repeat is a literal. Matches are
+	// meant to be searched with FindLongest.
+	ERE
+	// FoldCase makes literals, ranges and named classes such as [:upper:]
+	// or \p{Lu} match regardless of case, using Unicode simple case
+	// folding. Inside a pattern it is turned on and off with (?i) and
+	// (?-i).
+	FoldCase
+	// DotAll lets . match a newline, like (?s).
+	DotAll
+	// MultiLine makes ^ and $ match at the start and end of every line,
+	// like (?m).
+	MultiLine
+	// FreeSpacing ignores whitespace outside bracket expressions and starts
+	// a comment running to the end of the line at #, so that long patterns
+	// can be laid out over several lines. Escaped whitespace and # still
+	// match themselves. Inside a pattern it is turned on with (?x).
+	FreeSpacing
+	// StackedQuantifiers lets a quantifier apply to a quantified term, so
+	// that a** parses as (?:a*)* and a+?* as (?:a+?)*, as machine-generated
+	// patterns may have them; Simplify folds them back into one. A ? or +
+	// right after a quantifier still makes it lazy or possessive.
+	StackedQuantifiers
+)
+
+// groupFlags maps the letters accepted in (?flags) and (?flags:...) groups to
+// the flags they set.
+var groupFlags = map[rune]Flags{
+	'i': FoldCase,
+	's': DotAll,
+	'm': MultiLine,
+	'x': FreeSpacing,
+}
+
+// ParseError describes the first token the parser could not accept, along
+// with the byte offset of that token in the pattern and the token types that
+// would have been valid in its place.
+type ParseError struct {
+	Offset   int
+	Token    Token
+	Expected []TokenType
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	found := fmt.Sprintf("%q", e.Token.Value)
+	if e.Token.Type == EOF {
+		found = "end of pattern"
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("syntax error at offset %d near %s: %s", e.Offset, found, e.Message)
+	}
+	expected := make([]string, len(e.Expected))
+	for i, t := range e.Expected {
+		expected[i] = string(t)
+	}
+	return fmt.Sprintf("syntax error at offset %d: unexpected %s, expected %s", e.Offset, found, strings.Join(expected, " or "))
 }
 
+var factorTokens = []TokenType{LITERAL, DOT, ESCAPE, LBRACKET, LPAREN, CARET, DOLLAR}
+
 func NewParser(l *Lexer) *Parser {
-	p := &Parser{l: l}
+	return NewParserWithFlags(l, 0)
+}
+
+func NewParserWithFlags(l *Lexer, flags Flags) *Parser {
+	l.flags = flags
+	p := &Parser{l: l, flags: flags}
 	p.readNextToken()
 	p.readNextToken()
 	return p
 }
 
+// Parse parses pattern and returns its AST, or the first syntax error found.
+func Parse(pattern string) (Node, error) {
+	return ParseWithFlags(pattern, 0)
+}
+
+func ParseWithFlags(pattern string, flags Flags) (Node, error) {
+	p := NewParserWithFlags(New(pattern), flags)
+	node := p.Ast()
+	if len(p.errors) > 0 {
+		return nil, p.errors[0]
+	}
+	return node, nil
+}
+
+// metaChars are the characters with a meaning of their own outside bracket
+// expressions in the default syntax.
+const metaChars = `\.+*?()|[]{}^$`
+
+// QuoteMeta escapes the operators in text, so that the result parses, in the
+// default syntax, into a sequence of literals that matches text exactly.
+func QuoteMeta(text string) string {
+	var quoted strings.Builder
+	for _, char := range text {
+		if strings.ContainsRune(metaChars, char) {
+			quoted.WriteRune('\\')
+		}
+		quoted.WriteRune(char)
+	}
+	return quoted.String()
+}
+
+func (p *Parser) Errors() []*ParseError {
+	return p.errors
+}
+
 func (p *Parser) Ast() Node {
-	return p.parseExpression()
+	node := p.parseAlternation()
+	if !p.failed() && p.currentToken.Type != EOF {
+		p.unexpectedToken(EOF)
+	}
+	return node
+}
+
+func (p *Parser) parseAlternation() Node {
+	node := p.parseExpression()
+	if p.currentToken.Type != PIPE {
+		return node
+	}
+	alternation := &AlternationNode{Alternatives: []Node{node}}
+	for p.currentToken.Type == PIPE && !p.failed() {
+		p.readNextToken()
+		alternation.Alternatives = append(alternation.Alternatives, p.parseExpression())
+	}
+	return alternation
 }
 
 func (p *Parser) parseExpression() Node {
 	var node Node
 	sequence := &SequenceNode{}
 	node = sequence
-	for p.currentToken.Type != EOF {
+	for p.currentToken.Type != EOF && p.currentToken.Type != PIPE && p.currentToken.Type != RPAREN && !p.failed() {
+		if p.flags&BRE != 0 {
+			p.applyBasicContext(sequence.Children)
+		}
+		if p.flags&ERE != 0 {
+			p.applyExtendedContext(sequence.Children)
+		}
 		term := p.parseTerm()
 		if term != nil {
 			sequence.Children = append(sequence.Children, term)
@@ -30,17 +180,135 @@ func (p *Parser) parseExpression() Node {
 	return node
 }
 
+// applyBasicContext turns the current token into a literal where POSIX basic
+// syntax gives it no special meaning: * at the start of an expression, ^
+// anywhere but the start and $ anywhere but the end.
+func (p *Parser) applyBasicContext(preceding []Node) {
+	atStart := len(preceding) == 0
+	if len(preceding) == 1 {
+		anchor, ok := preceding[0].(*AssertionNode)
+		atStart = ok && (anchor.Value == CARET || anchor.Value == BEGIN_LINE)
+	}
+	atEnd := p.nextToken.Type == EOF || p.nextToken.Type == RPAREN
+	switch {
+	case p.currentToken.Type == STAR && atStart,
+		p.currentToken.Type == CARET && len(preceding) > 0,
+		p.currentToken.Type == DOLLAR && !atEnd:
+		p.currentToken.Type = LITERAL
+	case p.currentToken.Type == CARET && p.nextToken.Type == STAR:
+		// the anchor cannot be repeated, so ^* is an anchor and a literal *
+		p.nextToken.Type = LITERAL
+	}
+}
+
+// applyExtendedContext turns a quantifier with nothing to repeat, at the
+// start of an expression or right after ^, into a literal as egrep does.
+func (p *Parser) applyExtendedContext(preceding []Node) {
+	switch {
+	case len(preceding) == 0 && isQuantifierToken(p.currentToken.Type):
+		p.currentToken.Type = LITERAL
+	case p.currentToken.Type == CARET && isQuantifierToken(p.nextToken.Type):
+		p.nextToken.Type = LITERAL
+	}
+}
+
+func isQuantifierToken(t TokenType) bool {
+	return t == STAR || t == PLUS || t == QUESTION
+}
+
 func (p *Parser) parseTerm() Node {
 	factor := p.parseFactor()
-	if p.nextToken.Type == STAR {
-		star := &StarNode{}
-		star.Child = factor
+	if factor == nil {
+		if !p.failed() {
+			// a group such as (?i) only changed the flags
+			p.readNextToken()
+		}
+		return nil
+	}
+	term := factor
+	for {
+		quantifier := p.parseQuantifier(term)
+		if p.failed() {
+			return nil
+		}
+		if quantifier == nil {
+			break
+		}
+		term = quantifier
+		if p.flags&(StackedQuantifiers|ERE) == 0 {
+			break
+		}
+	}
+	p.readNextToken()
+	return term
+}
+
+// parseQuantifier returns child quantified by the quantifier following the
+// current token, or nil when there is none. The quantifier becomes the
+// current token.
+func (p *Parser) parseQuantifier(child Node) Node {
+	var quantifier Node
+	switch p.nextToken.Type {
+	case STAR:
+		quantifier = &StarNode{Child: child}
+	case PLUS:
+		quantifier = &PlusNode{Child: child}
+	case QUESTION:
+		quantifier = &QuestionNode{Child: child}
+	case REPEAT:
+		min, max, ok := parseRepeat(p.nextToken.Value)
+		if !ok {
+			p.readNextToken()
+			p.error(fmt.Sprintf("invalid repeat count %s", p.currentToken.Value))
+			return nil
+		}
+		quantifier = &RepeatNode{Child: child, Min: min, Max: max}
+	default:
+		return nil
+	}
+	p.readNextToken()
+	if p.flags&ERE != 0 {
+		// egrep has no lazy or possessive quantifiers, a following ? or +
+		// repeats this one
+		return quantifier
+	}
+	// a quantifier followed by ? is lazy and one followed by + possessive; in
+	// basic syntax both are literals and never get here
+	var b NodeBuilder
+	switch p.nextToken.Type {
+	case QUESTION:
+		quantifier = b.Lazy(quantifier)
 		p.readNextToken()
+	case PLUS:
+		quantifier = b.Possessive(quantifier)
 		p.readNextToken()
-		return star
 	}
-	p.readNextToken()
-	return factor
+	return quantifier
+}
+
+// maxRepeatCount is the largest count accepted in a repetition, as in RE2.
+const maxRepeatCount = 1000
+
+// parseRepeat extracts the bounds of a REPEAT token such as "{2,5}"; an open
+// upper bound is returned as -1. It reports false for counts above
+// maxRepeatCount and for an upper bound below the lower one.
+func parseRepeat(value string) (int, int, bool) {
+	bounds := strings.Split(value[1:len(value)-1], ",")
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil || min > maxRepeatCount {
+		return 0, 0, false
+	}
+	if len(bounds) == 1 {
+		return min, min, true
+	}
+	if bounds[1] == "" {
+		return min, -1, true
+	}
+	max, err := strconv.Atoi(bounds[1])
+	if err != nil || max > maxRepeatCount || max < min {
+		return 0, 0, false
+	}
+	return min, max, true
 }
 
 func (p *Parser) parseFactor() Node {
@@ -48,27 +316,388 @@ func (p *Parser) parseFactor() Node {
 	switch p.currentToken.Type {
 	case DOT:
 		node = &MetaCharacterNode{Value: "."}
-	case LITERAL:
-		node = &LiteralNode{Value: p.currentToken.Value[0]}
-	case ESCAPE:
-		p.readNextToken()
-		if p.currentToken.Value == "s" {
-			return &MetaCharacterNode{Value: WHITESPACE}
+		if p.flags&DotAll != 0 {
+			node = &MetaCharacterNode{Value: ANY_CHAR}
 		}
-		if p.currentToken.Value == "S" {
-			return &MetaCharacterNode{Value: NONWHITESPACE}
+	case LITERAL, RBRACKET:
+		node = p.literal(p.currentToken.Rune())
+	case CARET:
+		node = &AssertionNode{Value: CARET}
+		if p.flags&MultiLine != 0 {
+			node = &AssertionNode{Value: BEGIN_LINE}
 		}
+	case DOLLAR:
+		node = &AssertionNode{Value: DOLLAR}
+		if p.flags&MultiLine != 0 {
+			node = &AssertionNode{Value: END_LINE}
+		}
+	case ESCAPE:
+		return p.parseEscape()
+	case LPAREN:
+		return p.parseGroup()
 	case LBRACKET:
+		return p.parseCharList()
+	default:
+		p.unexpectedToken(factorTokens...)
+	}
+	return node
+}
+
+// parseGroup parses a parenthesized group. Flags set inside the group with
+// (?flags) only last until its closing parenthesis.
+func (p *Parser) parseGroup() Node {
+	flags := p.flags
+	defer func() {
+		p.flags = flags
+		p.updateLexerFlags()
+	}()
+	p.readNextToken()
+	group := &GroupNode{}
+	if p.currentToken.Type != QUESTION || p.flags&ERE != 0 {
+		// egrep has no (?...) groups, the ? is a literal
+		p.groups++
+		group.Index = p.groups
+	} else {
 		p.readNextToken()
-		charList := &CharList{}
-		for p.currentToken.Type != RBRACKET {
-			char := p.parseFactor()
-			charList.Chars = append(charList.Chars, char.(CharacterNode))
+		if p.isLookaround() {
+			return p.parseLookaround()
+		}
+		if p.currentToken.Type == LITERAL && p.currentToken.Value == ">" {
 			p.readNextToken()
+			atomic := &AtomicNode{Child: p.parseAlternation()}
+			if !p.failed() && p.currentToken.Type != RPAREN {
+				p.unexpectedToken(RPAREN)
+			}
+			return atomic
+		}
+		named := p.currentToken.Type == LITERAL && (p.currentToken.Value == "P" || p.currentToken.Value == "<")
+		if named && !p.parseGroupName(group) || !named && !p.parseGroupFlags() {
+			return nil
+		}
+		if p.currentToken.Type == RPAREN {
+			// (?flags) applies to the rest of the enclosing group
+			flags = p.flags
+			return nil
 		}
-		return charList
+		p.readNextToken()
 	}
-	return node
+	group.Child = p.parseAlternation()
+	if !p.failed() && p.currentToken.Type != RPAREN {
+		p.unexpectedToken(RPAREN)
+	}
+	return group
+}
+
+// isLookaround reports whether the tokens after (? start a lookahead (?= or
+// (?!, or a lookbehind (?<= or (?<!.
+func (p *Parser) isLookaround() bool {
+	if p.currentToken.Type != LITERAL {
+		return false
+	}
+	switch p.currentToken.Value {
+	case "=", "!":
+		return true
+	case "<":
+		return p.nextToken.Type == LITERAL && (p.nextToken.Value == "=" || p.nextToken.Value == "!")
+	}
+	return false
+}
+
+func (p *Parser) parseLookaround() Node {
+	lookaround := &LookaroundNode{Behind: p.currentToken.Value == "<"}
+	if lookaround.Behind {
+		p.readNextToken()
+	}
+	lookaround.Negated = p.currentToken.Value == "!"
+	p.readNextToken()
+	lookaround.Child = p.parseAlternation()
+	if !p.failed() && p.currentToken.Type != RPAREN {
+		p.unexpectedToken(RPAREN)
+	}
+	return lookaround
+}
+
+// parseGroupFlags reads the flags of a (?flags) or (?flags:...) group, such
+// as i or -i, and stops on the closing parenthesis or the colon. A group
+// without flags, (?:...), only groups without capturing.
+func (p *Parser) parseGroupFlags() bool {
+	negate := false
+	count := 0
+	for ; ; p.readNextToken() {
+		char := p.currentToken.Rune()
+		switch {
+		case p.currentToken.Type == RPAREN, p.currentToken.Type == LITERAL && char == ':':
+			if count == 0 && (negate || p.currentToken.Type == RPAREN) {
+				p.error("missing group flags")
+				return false
+			}
+			p.updateLexerFlags()
+			return true
+		case p.currentToken.Type == LITERAL && char == '-' && !negate:
+			negate = true
+			count = 0
+		case p.currentToken.Type == LITERAL && groupFlags[char] != 0:
+			if negate {
+				p.flags &^= groupFlags[char]
+			} else {
+				p.flags |= groupFlags[char]
+			}
+			count++
+		case p.currentToken.Type == EOF:
+			p.unexpectedToken(RPAREN)
+			return false
+		default:
+			p.error(fmt.Sprintf("invalid group flag %s", p.currentToken.Value))
+			return false
+		}
+	}
+}
+
+// updateLexerFlags hands the flags changed by a group over to the lexer. The
+// token after the current one was read ahead with the previous flags, so it
+// is lexed again.
+func (p *Parser) updateLexerFlags() {
+	if p.l.flags == p.flags {
+		return
+	}
+	p.l.flags = p.flags
+	p.l.Rewind(p.currentToken.Position + len(p.currentToken.Value))
+	p.nextToken = p.l.NextToken()
+}
+
+// parseGroupName reads the name of a (?P<name>...) or (?<name>...) group and
+// stops on the closing angle bracket.
+func (p *Parser) parseGroupName(group *GroupNode) bool {
+	if p.currentToken.Value == "P" {
+		p.readNextToken()
+		if p.currentToken.Value != "<" {
+			p.error("invalid group name, expected < after (?P")
+			return false
+		}
+	}
+	name := ""
+	for p.readNextToken(); p.currentToken.Value != ">"; p.readNextToken() {
+		if p.currentToken.Type == EOF {
+			p.unexpectedToken(LITERAL)
+			return false
+		}
+		if p.currentToken.Type != LITERAL || !isWordChar(p.currentToken.Rune()) {
+			p.error(fmt.Sprintf("invalid character %s in group name", p.currentToken.Value))
+			return false
+		}
+		name += p.currentToken.Value
+	}
+	if name == "" {
+		p.error("missing group name")
+		return false
+	}
+	if p.names[name] {
+		p.error(fmt.Sprintf("duplicate group name %s", name))
+		return false
+	}
+	if p.names == nil {
+		p.names = make(map[string]bool)
+	}
+	p.names[name] = true
+	p.groups++
+	group.Index = p.groups
+	group.Name = name
+	return true
+}
+
+// literal builds a LiteralNode that honours the FoldCase flag in effect.
+func (p *Parser) literal(char rune) *LiteralNode {
+	return &LiteralNode{Value: char, FoldCase: p.flags&FoldCase != 0}
+}
+
+func (p *Parser) parseEscape() Node {
+	p.readNextToken()
+	value := p.currentToken.Value
+	if value == "" {
+		p.unexpectedToken(LITERAL)
+		return nil
+	}
+	if p.flags&ERE != 0 && (value < "1" || value > "9") {
+		// egrep has no Perl escapes, a backslash only quotes the next
+		// character
+		return p.literal(p.currentToken.Rune())
+	}
+	switch value {
+	case "s", "S", "d", "D", "w", "W":
+		return &MetaCharacterNode{Value: "\\" + value}
+	case "A", "z", "b", "B":
+		return &AssertionNode{Value: "\\" + value}
+	case "t":
+		return p.literal('\t')
+	case "n":
+		return p.literal('\n')
+	case "r":
+		return p.literal('\r')
+	case "f":
+		return p.literal('\f')
+	case "v":
+		return p.literal('\v')
+	case "x":
+		return p.parseHexEscape()
+	case "p", "P":
+		return p.parseUnicodeClass(value)
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		index, _ := strconv.Atoi(value)
+		if index > p.groups {
+			p.error(fmt.Sprintf("invalid backreference \\%s to a group that does not exist", value))
+			return nil
+		}
+		return &BackreferenceNode{Index: index, FoldCase: p.flags&FoldCase != 0}
+	}
+	char := p.currentToken.Rune()
+	if char < utf8.RuneSelf && isAlphanumeric(byte(char)) {
+		p.error(fmt.Sprintf("invalid escape sequence \\%s", value))
+		return nil
+	}
+	return p.literal(char)
+}
+
+// parseHexEscape reads the two hex digits of a \xHH escape.
+func (p *Parser) parseHexEscape() Node {
+	var value rune
+	for i := 0; i < 2; i++ {
+		p.readNextToken()
+		digit, err := strconv.ParseUint(p.currentToken.Value, 16, 8)
+		if p.currentToken.Type != LITERAL || err != nil {
+			p.error("invalid hexadecimal escape, expected two hex digits after \\x")
+			return nil
+		}
+		value = value*16 + rune(digit)
+	}
+	return p.literal(value)
+}
+
+// parseUnicodeClass reads the name of a \p{Name} or \P{Name} class, which
+// may also be written \pL for a one letter name, and returns it as a meta
+// character in the \p{Name} form.
+func (p *Parser) parseUnicodeClass(escape string) Node {
+	p.readNextToken()
+	name := p.currentToken.Value
+	if p.currentToken.Type == LITERAL && name == "{" {
+		name = ""
+		for p.readNextToken(); p.currentToken.Value != "}"; p.readNextToken() {
+			if p.currentToken.Type == EOF {
+				p.unexpectedToken(LITERAL)
+				return nil
+			}
+			name += p.currentToken.Value
+		}
+	}
+	if p.currentToken.Type == EOF {
+		p.unexpectedToken(LITERAL)
+		return nil
+	}
+	value := "\\" + escape + "{" + name + "}"
+	if _, ok := namedClass(value); !ok {
+		p.error(fmt.Sprintf("invalid Unicode class name %s", name))
+		return nil
+	}
+	return &MetaCharacterNode{Value: value, FoldCase: p.flags&FoldCase != 0}
+}
+
+func isAlphanumeric(ch byte) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func (p *Parser) parseCharList() Node {
+	p.readNextToken()
+	charList := &CharList{}
+	if p.currentToken.Type == CARET {
+		charList.Negated = true
+		p.readNextToken()
+	}
+	if p.currentToken.Type == RBRACKET {
+		p.unexpectedToken(LITERAL, ESCAPE, DOT)
+		return nil
+	}
+	for p.currentToken.Type != RBRACKET {
+		chars := p.parseCharListItem()
+		if chars == nil {
+			return nil
+		}
+		charList.Chars = append(charList.Chars, chars...)
+		p.readNextToken()
+	}
+	return charList
+}
+
+func (p *Parser) parseCharListItem() []CharacterNode {
+	char := p.parseCharListAtom()
+	if char == nil {
+		return nil
+	}
+	from, ok := char.(*LiteralNode)
+	if !ok || p.nextToken.Value != "-" {
+		return []CharacterNode{char}
+	}
+	p.readNextToken()
+	if p.nextToken.Type == RBRACKET {
+		return []CharacterNode{from, p.literal('-')}
+	}
+	p.readNextToken()
+	toChar := p.parseCharListAtom()
+	if toChar == nil {
+		return nil
+	}
+	to, ok := toChar.(*LiteralNode)
+	if !ok || to.Value < from.Value {
+		p.error(fmt.Sprintf("invalid character class range %s-%s", from.String(), toChar.String()))
+		return nil
+	}
+	return []CharacterNode{&RangeNode{From: from.Value, To: to.Value, FoldCase: p.flags&FoldCase != 0}}
+}
+
+func (p *Parser) parseCharListAtom() CharacterNode {
+	switch p.currentToken.Type {
+	case EOF:
+		p.unexpectedToken(RBRACKET)
+		return nil
+	case ESCAPE:
+		escaped := p.parseEscape()
+		if escaped == nil {
+			return nil
+		}
+		char, ok := escaped.(CharacterNode)
+		if !ok {
+			p.error(fmt.Sprintf("invalid escape sequence \\%s in character class", p.currentToken.Value))
+			return nil
+		}
+		return char
+	case DOT:
+		return &MetaCharacterNode{Value: DOT}
+	case POSIXCLASS:
+		if _, ok := posixClasses[p.currentToken.Value]; !ok {
+			p.error(fmt.Sprintf("invalid character class name %s", p.currentToken.Value))
+			return nil
+		}
+		return &MetaCharacterNode{Value: p.currentToken.Value, FoldCase: p.flags&FoldCase != 0}
+	}
+	return p.literal(p.currentToken.Rune())
+}
+
+func (p *Parser) failed() bool {
+	return len(p.errors) > 0
+}
+
+func (p *Parser) unexpectedToken(expected ...TokenType) {
+	p.errors = append(p.errors, &ParseError{
+		Offset:   p.currentToken.Position,
+		Token:    p.currentToken,
+		Expected: expected,
+	})
+}
+
+func (p *Parser) error(message string) {
+	p.errors = append(p.errors, &ParseError{
+		Offset:  p.currentToken.Position,
+		Token:   p.currentToken,
+		Message: message,
+	})
 }
 
 func (p *Parser) readNextToken() {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -15,6 +16,10 @@ func testLiteralNode(t *testing.T, actual *LiteralNode, expected Node) bool {
 		t.Errorf("LiteralNode values are different, expected=%b, actual=%b", expectedLiteral.Value, actual.Value)
 		return false
 	}
+	if expectedLiteral.FoldCase != actual.FoldCase {
+		t.Errorf("LiteralNode %q case folding is different, expected=%t, actual=%t", actual.Value, expectedLiteral.FoldCase, actual.FoldCase)
+		return false
+	}
 	return true
 }
 
@@ -29,6 +34,10 @@ func testMetaCharacter(t *testing.T, actual *MetaCharacterNode, expected Node) b
 		t.Errorf("LiteralNode values are different, expected=%s, actual=%s", expectedLiteral.Value, actual.Value)
 		return false
 	}
+	if expectedLiteral.FoldCase != actual.FoldCase {
+		t.Errorf("MetaCharacterNode %s case folding is different, expected=%t, actual=%t", actual.Value, expectedLiteral.FoldCase, actual.FoldCase)
+		return false
+	}
 	return true
 }
 
@@ -38,6 +47,10 @@ func testStartNode(t *testing.T, actual *StarNode, expected Node) bool {
 		t.Error("expected node is not a StarNode")
 		return false
 	}
+	if actual.Lazy != expectedStar.Lazy || actual.Possessive != expectedStar.Possessive {
+		t.Errorf("StarNode mode is different, expected %q, actual %q", expectedStar.String(), actual.String())
+		return false
+	}
 
 	return testNode(t, actual.Child, expectedStar.Child)
 }
@@ -49,6 +62,14 @@ func testCharListNode(t *testing.T, actual *CharList, expected Node) bool {
 		return false
 	}
 
+	if actual.Negated != expectedCharList.Negated {
+		t.Errorf("CharList negation is different, expected %t, actual %t", expectedCharList.Negated, actual.Negated)
+		return false
+	}
+	if len(actual.Chars) != len(expectedCharList.Chars) {
+		t.Errorf("expected %d characters in CharList, got %d", len(expectedCharList.Chars), len(actual.Chars))
+		return false
+	}
 	for i := 0; i < len(actual.Chars); i++ {
 		expectedChar := expectedCharList.Chars[i]
 		actualChar := actual.Chars[i]
@@ -67,12 +88,40 @@ func testNode(t *testing.T, actual Node, expected Node) bool {
 		result = testLiteralNode(t, actual.(*LiteralNode), expected)
 	case *StarNode:
 		result = testStartNode(t, actual.(*StarNode), expected)
+	case *RangeNode:
+		expectedRange, ok := expected.(*RangeNode)
+		result = ok && v.From == expectedRange.From && v.To == expectedRange.To && v.FoldCase == expectedRange.FoldCase
 	case *CharList:
 		result = testCharListNode(t, actual.(*CharList), expected)
 	case *MetaCharacterNode:
 		result = testMetaCharacter(t, actual.(*MetaCharacterNode), expected)
 	case *SequenceNode:
 		result = testSequenceNode(t, actual.(*SequenceNode), expected)
+	case *PlusNode:
+		expectedPlus := expected.(*PlusNode)
+		result = v.Lazy == expectedPlus.Lazy && v.Possessive == expectedPlus.Possessive && testNode(t, v.Child, expectedPlus.Child)
+	case *QuestionNode:
+		expectedQuestion := expected.(*QuestionNode)
+		result = v.Lazy == expectedQuestion.Lazy && v.Possessive == expectedQuestion.Possessive && testNode(t, v.Child, expectedQuestion.Child)
+	case *AtomicNode:
+		expectedAtomic, ok := expected.(*AtomicNode)
+		result = ok && testNode(t, v.Child, expectedAtomic.Child)
+	case *RepeatNode:
+		result = testRepeatNode(t, v, expected)
+	case *AssertionNode:
+		expectedAssertion, ok := expected.(*AssertionNode)
+		result = ok && v.Value == expectedAssertion.Value
+	case *LookaroundNode:
+		expectedLookaround, ok := expected.(*LookaroundNode)
+		result = ok && v.Behind == expectedLookaround.Behind && v.Negated == expectedLookaround.Negated &&
+			testNode(t, v.Child, expectedLookaround.Child)
+	case *BackreferenceNode:
+		expectedBackref, ok := expected.(*BackreferenceNode)
+		result = ok && v.Index == expectedBackref.Index && v.FoldCase == expectedBackref.FoldCase
+	case *AlternationNode:
+		result = testAlternationNode(t, actual.(*AlternationNode), expected)
+	case *GroupNode:
+		result = testGroupNode(t, actual.(*GroupNode), expected)
 	default:
 		t.Fatalf("unknown type %T", v)
 	}
@@ -103,6 +152,50 @@ func testSequenceNode(t *testing.T, actual *SequenceNode, expectedNode Node) boo
 	return true
 }
 
+func testAlternationNode(t *testing.T, actual *AlternationNode, expectedNode Node) bool {
+	expected, ok := expectedNode.(*AlternationNode)
+	if !ok {
+		t.Error("expected node is not an AlternationNode")
+		return false
+	}
+	if len(actual.Alternatives) != len(expected.Alternatives) {
+		t.Fatalf("expected %d alternatives in AlternationNode, got %d", len(expected.Alternatives), len(actual.Alternatives))
+		return false
+	}
+	for i, alt := range actual.Alternatives {
+		if testNode(t, alt, expected.Alternatives[i]) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func testGroupNode(t *testing.T, actual *GroupNode, expectedNode Node) bool {
+	expected, ok := expectedNode.(*GroupNode)
+	if !ok {
+		t.Error("expected node is not a GroupNode")
+		return false
+	}
+	if actual.Name != expected.Name {
+		t.Errorf("GroupNode names are different, expected %q, actual %q", expected.Name, actual.Name)
+		return false
+	}
+	return testNode(t, actual.Child, expected.Child)
+}
+
+func testRepeatNode(t *testing.T, actual *RepeatNode, expectedNode Node) bool {
+	expected, ok := expectedNode.(*RepeatNode)
+	if !ok {
+		t.Error("expected node is not a RepeatNode")
+		return false
+	}
+	if actual.Min != expected.Min || actual.Max != expected.Max || actual.Lazy != expected.Lazy || actual.Possessive != expected.Possessive {
+		t.Errorf("RepeatNode bounds are different, expected={%d,%d}, actual={%d,%d}", expected.Min, expected.Max, actual.Min, actual.Max)
+		return false
+	}
+	return testNode(t, actual.Child, expected.Child)
+}
+
 var b NodeBuilder
 
 func TestRegexParser(t *testing.T) {
@@ -140,15 +233,583 @@ func TestRegexParser(t *testing.T) {
 			b.Lit(' '),
 			b.Lit('{'),
 		),
+		"ab|c": b.Alt(
+			b.Seq(b.Lit('a'), b.Lit('b')),
+			b.Seq(b.Lit('c')),
+		),
+		"a(bc)*d": b.Seq(
+			b.Lit('a'),
+			b.Star(b.Group(b.Seq(b.Lit('b'), b.Lit('c')))),
+			b.Lit('d'),
+		),
+		"a(b|c|)": b.Seq(
+			b.Lit('a'),
+			b.Group(b.Alt(
+				b.Seq(b.Lit('b')),
+				b.Seq(b.Lit('c')),
+				b.Seq(),
+			)),
+		),
+		"a+b?": b.Seq(
+			b.Plus(b.Lit('a')),
+			b.Question(b.Lit('b')),
+		),
+		"a{2}b{2,}c{2,5}": b.Seq(
+			b.Repeat(b.Lit('a'), 2, 2),
+			b.Repeat(b.Lit('b'), 2, -1),
+			b.Repeat(b.Lit('c'), 2, 5),
+		),
+		"(ab)+": b.Seq(
+			b.Plus(b.Group(b.Seq(b.Lit('a'), b.Lit('b')))),
+		),
+		"^a\\b\\B$": b.Seq(
+			b.Assert(CARET),
+			b.Lit('a'),
+			b.Assert(WORD_BOUNDARY),
+			b.Assert(NON_WORD_BOUNDARY),
+			b.Assert(DOLLAR),
+		),
+		"\\Aa\\z": b.Seq(
+			b.Assert(BEGIN_TEXT),
+			b.Lit('a'),
+			b.Assert(END_TEXT),
+		),
+		"\\d\\D\\w\\W": b.Seq(
+			b.Meta(DIGIT),
+			b.Meta(NONDIGIT),
+			b.Meta(WORD),
+			b.Meta(NONWORD),
+		),
+		"\\t\\n\\x41\\.\\*\\[\\\\": b.Seq(
+			b.Lit('\t'),
+			b.Lit('\n'),
+			b.Lit('A'),
+			b.Lit('.'),
+			b.Lit('*'),
+			b.Lit('['),
+			b.Lit('\\'),
+		),
+		"[\\d\\]\\-]": b.Seq(
+			b.List(b.Meta(DIGIT), b.Lit(']'), b.Lit('-')),
+		),
+		"[\\x00-\\x1f]": b.Seq(
+			b.List(b.Range(0x00, 0x1f)),
+		),
+		"é[α-ω]日*": b.Seq(
+			b.Lit('é'),
+			b.List(b.Range('α', 'ω')),
+			b.Star(b.Lit('日')),
+		),
+		"\\€": b.Seq(
+			b.Lit('€'),
+		),
+		"(a(b))": b.Seq(
+			b.Group(b.Seq(
+				b.Lit('a'),
+				b.Group(b.Seq(b.Lit('b'))),
+			)),
+		),
 	}
 	for key, val := range cases {
 		l := New(key)
 		parser := NewParser(l)
 		node := parser.Ast()
-		ok := testNode(t, node.(*SequenceNode), val)
+		ok := testNode(t, node, val)
 		if !ok {
 			t.Fatalf("expected SequenceNode, got %T", node)
 		}
 	}
 
 }
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		offset   int
+		token    TokenType
+		expected []TokenType
+	}{
+		{"[abc", 4, EOF, []TokenType{RBRACKET}},
+		{"ab\\", 3, EOF, []TokenType{LITERAL}},
+		{"(ab", 3, EOF, []TokenType{RPAREN}},
+		{"ab)c", 2, RPAREN, []TokenType{EOF}},
+		{"*a", 0, STAR, factorTokens},
+		{"a|+", 2, PLUS, factorTokens},
+		{"a**", 2, STAR, factorTokens},
+		{"[]", 1, RBRACKET, []TokenType{LITERAL, ESCAPE, DOT}},
+		{"a\\q", 2, LITERAL, nil},
+		{"a{3,2}", 1, REPEAT, nil},
+		{"a{1001}", 1, REPEAT, nil},
+		{"a{2,4611686018427387904}", 1, REPEAT, nil},
+		{"a{99999999999999999999}", 1, REPEAT, nil},
+		{"[z-a]", 3, LITERAL, nil},
+		{"[^]", 2, RBRACKET, []TokenType{LITERAL, ESCAPE, DOT}},
+		{"[a\\b]", 3, LITERAL, nil},
+		{"\\x4g", 3, LITERAL, nil},
+		{"\\x4", 3, EOF, nil},
+		{"[[:word:]]", 1, POSIXCLASS, nil},
+		{"(?)", 2, RPAREN, nil},
+		{"(?z)", 2, LITERAL, nil},
+		{"(?i", 3, EOF, []TokenType{RPAREN}},
+		{"(?i)*", 4, STAR, factorTokens},
+		{"(?-i-i)", 4, LITERAL, nil},
+		{"(?-:a)", 3, LITERAL, nil},
+		{"(?P<>a)", 4, LITERAL, nil},
+		{"(?<a-b>x)", 4, LITERAL, nil},
+		{"(?P<a>x)(?<a>y)", 12, LITERAL, nil},
+		{"(?P=a)", 3, LITERAL, nil},
+		{"(?<a", 4, EOF, []TokenType{LITERAL}},
+		{"a*??", 3, QUESTION, factorTokens},
+		{"(a)\\2", 4, LITERAL, nil},
+		{"\\1(a)", 1, LITERAL, nil},
+		{"(a)[\\1]", 5, LITERAL, nil},
+		{"(?=a", 4, EOF, []TokenType{RPAREN}},
+		{"a*+?", 3, QUESTION, factorTokens},
+		{"(?>a", 4, EOF, []TokenType{RPAREN}},
+		{"\\p{Klingon}", 10, LITERAL, nil},
+		{"\\p{L", 4, EOF, []TokenType{LITERAL}},
+		{"\\p", 2, EOF, []TokenType{LITERAL}},
+	}
+
+	for _, c := range cases {
+		node, err := Parse(c.pattern)
+		if err == nil {
+			t.Fatalf("Parse(%q) = %v, expected an error", c.pattern, node)
+		}
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Parse(%q) returned %T, expected *ParseError", c.pattern, err)
+		}
+		if parseErr.Offset != c.offset {
+			t.Errorf("Parse(%q) error offset = %d, want %d (%v)", c.pattern, parseErr.Offset, c.offset, err)
+		}
+		if parseErr.Token.Type != c.token {
+			t.Errorf("Parse(%q) error token = %q, want %q", c.pattern, parseErr.Token.Type, c.token)
+		}
+		if !slices.Equal(parseErr.Expected, c.expected) {
+			t.Errorf("Parse(%q) expected tokens = %v, want %v", c.pattern, parseErr.Expected, c.expected)
+		}
+	}
+}
+
+func TestParseOperatorsInsideBrackets(t *testing.T) {
+	cases := map[string]Node{
+		"[*]":    b.Seq(b.List(b.Lit('*'))),
+		"[(|)]":  b.Seq(b.List(b.Lit('('), b.Lit('|'), b.Lit(')'))),
+		"[a{2}]": b.Seq(b.List(b.Lit('a'), b.Lit('{'), b.Lit('2'), b.Lit('}'))),
+		"a]":     b.Seq(b.Lit('a'), b.Lit(']')),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseCharListRanges(t *testing.T) {
+	cases := map[string]Node{
+		"[a-z]":        b.Seq(b.List(b.Range('a', 'z'))),
+		"[^a-z]":       b.Seq(b.NotList(b.Range('a', 'z'))),
+		"[a-zA-Z_]":    b.Seq(b.List(b.Range('a', 'z'), b.Range('A', 'Z'), b.Lit('_'))),
+		"[-a]":         b.Seq(b.List(b.Lit('-'), b.Lit('a'))),
+		"[a-]":         b.Seq(b.List(b.Lit('a'), b.Lit('-'))),
+		"[^^]":         b.Seq(b.NotList(b.Lit('^'))),
+		"[a^]":         b.Seq(b.List(b.Lit('a'), b.Lit('^'))),
+		"[$]":          b.Seq(b.List(b.Lit('$'))),
+		"[0-9\\s]":     b.Seq(b.List(b.Range('0', '9'), b.Meta(WHITESPACE))),
+		"[[:alpha:]_]": b.Seq(b.List(b.Meta("[:alpha:]"), b.Lit('_'))),
+		"[^[:digit:]]": b.Seq(b.NotList(b.Meta("[:digit:]"))),
+		"[[:alpha]":    b.Seq(b.List(b.Lit('['), b.Lit(':'), b.Lit('a'), b.Lit('l'), b.Lit('p'), b.Lit('h'), b.Lit('a'))),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseBasicSyntax(t *testing.T) {
+	cases := map[string]Node{
+		"a\\(bc\\)*d": b.Seq(
+			b.Lit('a'),
+			b.Star(b.Group(b.Seq(b.Lit('b'), b.Lit('c')))),
+			b.Lit('d'),
+		),
+		"a\\{2,3\\}b\\{2\\}": b.Seq(
+			b.Repeat(b.Lit('a'), 2, 3),
+			b.Repeat(b.Lit('b'), 2, 2),
+		),
+		"*a":  b.Seq(b.Lit('*'), b.Lit('a')),
+		"^*a": b.Seq(b.Assert(CARET), b.Lit('*'), b.Lit('a')),
+		"a^b$c$": b.Seq(
+			b.Lit('a'),
+			b.Lit('^'),
+			b.Lit('b'),
+			b.Lit('$'),
+			b.Lit('c'),
+			b.Assert(DOLLAR),
+		),
+		"a*?": b.Seq(b.Star(b.Lit('a')), b.Lit('?')),
+		"(a|b)+?{2}": b.Seq(
+			b.Lit('('), b.Lit('a'), b.Lit('|'), b.Lit('b'), b.Lit(')'),
+			b.Lit('+'), b.Lit('?'), b.Lit('{'), b.Lit('2'), b.Lit('}'),
+		),
+		"\\(^a$\\)": b.Seq(
+			b.Group(b.Seq(b.Assert(CARET), b.Lit('a'), b.Assert(DOLLAR))),
+		),
+		"\\(*a\\)": b.Seq(
+			b.Group(b.Seq(b.Lit('*'), b.Lit('a'))),
+		),
+		"[]a]":       b.Seq(b.List(b.Lit(']'), b.Lit('a'))),
+		"[^]a]":      b.Seq(b.NotList(b.Lit(']'), b.Lit('a'))),
+		"[\\.]":      b.Seq(b.List(b.Lit('\\'), b.Lit('.'))),
+		"[a-c]*":     b.Seq(b.Star(b.List(b.Range('a', 'c')))),
+		"\\(a\\)\\1": b.Seq(b.Capture(1, b.Seq(b.Lit('a'))), b.Backref(1)),
+	}
+	for key, val := range cases {
+		node, err := ParseWithFlags(key, BRE)
+		if err != nil {
+			t.Fatalf("ParseWithFlags(%q, BRE) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseExtendedSyntax(t *testing.T) {
+	cases := map[string]Node{
+		"(a|b)+c{2}": b.Seq(
+			b.Plus(b.Group(b.Alt(b.Seq(b.Lit('a')), b.Seq(b.Lit('b'))))),
+			b.Repeat(b.Lit('c'), 2, 2),
+		),
+		"[]\\.]":        b.Seq(b.List(b.Lit(']'), b.Lit('\\'), b.Lit('.'))),
+		"[[:space:]\\]": b.Seq(b.List(b.Meta("[:space:]"), b.Lit('\\'))),
+		"\\.\\(":        b.Seq(b.Lit('.'), b.Lit('(')),
+		"\\d\\w\\x":     b.Seq(b.Lit('d'), b.Lit('w'), b.Lit('x')),
+		"(a)\\1":        b.Seq(b.Capture(1, b.Seq(b.Lit('a'))), b.Backref(1)),
+		"*a|+b":         b.Alt(b.Seq(b.Lit('*'), b.Lit('a')), b.Seq(b.Lit('+'), b.Lit('b'))),
+		"^*":            b.Seq(b.Assert(CARET), b.Lit('*')),
+		"(?i)":          b.Seq(b.Group(b.Seq(b.Lit('?'), b.Lit('i')))),
+		"a+?":           b.Seq(b.Question(b.Plus(b.Lit('a')))),
+		"a*+":           b.Seq(b.Plus(b.Star(b.Lit('a')))),
+		"a{2}?":         b.Seq(b.Question(b.Repeat(b.Lit('a'), 2, 2))),
+	}
+	for key, val := range cases {
+		node, err := ParseWithFlags(key, ERE)
+		if err != nil {
+			t.Fatalf("ParseWithFlags(%q, ERE) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseGroupFlags(t *testing.T) {
+	cases := map[string]Node{
+		"(?i)ab": b.Seq(b.FoldLit('a'), b.FoldLit('b')),
+		"a(?i:b)c": b.Seq(
+			b.Lit('a'),
+			b.Group(b.Seq(b.FoldLit('b'))),
+			b.Lit('c'),
+		),
+		"(a(?i)b)c": b.Seq(
+			b.Group(b.Seq(b.Lit('a'), b.FoldLit('b'))),
+			b.Lit('c'),
+		),
+		"(?i)a(?-i)b":    b.Seq(b.FoldLit('a'), b.Lit('b')),
+		"(?i)[a-z\\x41]": b.Seq(b.List(b.FoldRange('a', 'z'), b.FoldLit('A'))),
+		"(?i)[[:upper:]\\d]\\p{Lu}\\w": b.Seq(
+			b.List(b.FoldMeta("[:upper:]"), b.Meta(DIGIT)),
+			b.FoldMeta("\\p{Lu}"),
+			b.Meta(WORD),
+		),
+		"(?i)a|b": b.Alt(
+			b.Seq(b.FoldLit('a')),
+			b.Seq(b.FoldLit('b')),
+		),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+
+	node, err := ParseWithFlags("a(?-i)b", FoldCase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNode(t, node, b.Seq(b.FoldLit('a'), b.Lit('b')))
+}
+
+func TestParseLineFlags(t *testing.T) {
+	cases := map[string]Node{
+		".(?s).":     b.Seq(b.Meta(DOT), b.Meta(ANY_CHAR)),
+		"(?m)^a$":    b.Seq(b.Assert(BEGIN_LINE), b.Lit('a'), b.Assert(END_LINE)),
+		"(?ms:^.)$":  b.Seq(b.Group(b.Seq(b.Assert(BEGIN_LINE), b.Meta(ANY_CHAR))), b.Assert(DOLLAR)),
+		"(?is-m)^k":  b.Seq(b.Assert(CARET), b.FoldLit('k')),
+		"(?s)[.]\\A": b.Seq(b.List(b.Meta(DOT)), b.Assert(BEGIN_TEXT)),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseGroupIndex(t *testing.T) {
+	node, err := Parse("(a(?:b)(c(?i:d)))|(e)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []int
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *GroupNode:
+			indexes = append(indexes, n.Index)
+			walk(n.Child)
+		case *SequenceNode:
+			for _, child := range n.Children {
+				walk(child)
+			}
+		case *AlternationNode:
+			for _, alt := range n.Alternatives {
+				walk(alt)
+			}
+		}
+	}
+	walk(node)
+	if expected := []int{1, 0, 2, 0, 3}; !slices.Equal(indexes, expected) {
+		t.Errorf("group indexes = %v, want %v", indexes, expected)
+	}
+}
+
+func TestParseNamedGroups(t *testing.T) {
+	node, err := Parse("(?P<key>\\w+)=(v)(?<value>.*)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNode(t, node, b.Seq(
+		b.Named(1, "key", b.Seq(b.Plus(b.Meta(WORD)))),
+		b.Lit('='),
+		b.Capture(2, b.Seq(b.Lit('v'))),
+		b.Named(3, "value", b.Seq(b.Star(b.Meta(DOT)))),
+	))
+	if names := SubexpNames(node); !slices.Equal(names, []string{"", "key", "", "value"}) {
+		t.Errorf("SubexpNames() = %q", names)
+	}
+}
+
+func TestParseLazyQuantifiers(t *testing.T) {
+	cases := map[string]Node{
+		"a*?b":    b.Seq(b.Lazy(b.Star(b.Lit('a'))), b.Lit('b')),
+		"a+?":     b.Seq(b.Lazy(b.Plus(b.Lit('a')))),
+		"a??":     b.Seq(b.Lazy(b.Question(b.Lit('a')))),
+		"a{2,}?":  b.Seq(b.Lazy(b.Repeat(b.Lit('a'), 2, -1))),
+		"(ab)*?c": b.Seq(b.Lazy(b.Star(b.Group(b.Seq(b.Lit('a'), b.Lit('b'))))), b.Lit('c')),
+		"a?b*":    b.Seq(b.Question(b.Lit('a')), b.Star(b.Lit('b'))),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseBackreferences(t *testing.T) {
+	cases := map[string]Node{
+		"(a)\\1": b.Seq(b.Capture(1, b.Seq(b.Lit('a'))), b.Backref(1)),
+		"(a(b))\\2\\1": b.Seq(
+			b.Capture(1, b.Seq(b.Lit('a'), b.Capture(2, b.Seq(b.Lit('b'))))),
+			b.Backref(2),
+			b.Backref(1),
+		),
+		"(a)\\1+": b.Seq(b.Capture(1, b.Seq(b.Lit('a'))), b.Plus(b.Backref(1))),
+		"(?i)(a)\\1": b.Seq(
+			b.Capture(1, b.Seq(b.FoldLit('a'))),
+			&BackreferenceNode{Index: 1, FoldCase: true},
+		),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseLookarounds(t *testing.T) {
+	cases := map[string]Node{
+		"a(?=b)": b.Seq(b.Lit('a'), b.Lookaround(b.Seq(b.Lit('b')), false, false)),
+		"a(?!b|c)": b.Seq(
+			b.Lit('a'),
+			b.Lookaround(b.Alt(b.Seq(b.Lit('b')), b.Seq(b.Lit('c'))), false, true),
+		),
+		"(?<=a)b":  b.Seq(b.Lookaround(b.Seq(b.Lit('a')), true, false), b.Lit('b')),
+		"(?<!a)b":  b.Seq(b.Lookaround(b.Seq(b.Lit('a')), true, true), b.Lit('b')),
+		"(?<a>b)":  b.Seq(b.Named(1, "a", b.Seq(b.Lit('b')))),
+		"(?=(a))b": b.Seq(b.Lookaround(b.Seq(b.Capture(1, b.Seq(b.Lit('a')))), false, false), b.Lit('b')),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParsePossessiveAndAtomic(t *testing.T) {
+	cases := map[string]Node{
+		"a*+":      b.Seq(b.Possessive(b.Star(b.Lit('a')))),
+		"a++b":     b.Seq(b.Possessive(b.Plus(b.Lit('a'))), b.Lit('b')),
+		"a?+":      b.Seq(b.Possessive(b.Question(b.Lit('a')))),
+		"a{2,}+":   b.Seq(b.Possessive(b.Repeat(b.Lit('a'), 2, -1))),
+		"(?>ab)c":  b.Seq(b.Atomic(b.Seq(b.Lit('a'), b.Lit('b'))), b.Lit('c')),
+		"(?>a|b)+": b.Seq(b.Plus(b.Atomic(b.Alt(b.Seq(b.Lit('a')), b.Seq(b.Lit('b')))))),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+
+	node, err := ParseWithFlags("a*+", BRE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNode(t, node, b.Seq(b.Star(b.Lit('a')), b.Lit('+')))
+}
+
+func TestParseUnicodeClasses(t *testing.T) {
+	cases := map[string]Node{
+		"\\p{L}":           b.Seq(b.Meta("\\p{L}")),
+		"\\pL\\PN":         b.Seq(b.Meta("\\p{L}"), b.Meta("\\P{N}")),
+		"\\P{Greek}+":      b.Seq(b.Plus(b.Meta("\\P{Greek}"))),
+		"[\\p{Lu}_-]":      b.Seq(b.List(b.Meta("\\p{Lu}"), b.Lit('_'), b.Lit('-'))),
+		"[^\\p{Cyrillic}]": b.Seq(b.NotList(b.Meta("\\p{Cyrillic}"))),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestParseQuotedSpans(t *testing.T) {
+	cases := map[string]Node{
+		"\\Qa.b\\E":   b.Seq(b.Lit('a'), b.Lit('.'), b.Lit('b')),
+		"\\Q(?i)\\E*": b.Seq(b.Lit('('), b.Lit('?'), b.Lit('i'), b.Star(b.Lit(')'))),
+		"x\\Q\\Ey":    b.Seq(b.Lit('x'), b.Lit('y')),
+		"\\Q\\d|":     b.Seq(b.Lit('\\'), b.Lit('d'), b.Lit('|')),
+		"[\\Q]^\\E]":  b.Seq(b.List(b.Lit(']'), b.Lit('^'))),
+		"\\\\Q":       b.Seq(b.Lit('\\'), b.Lit('Q')),
+		"(?i)\\Qk\\E": b.Seq(b.FoldLit('k')),
+	}
+	for key, val := range cases {
+		node, err := Parse(key)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", key, err)
+		}
+		testNode(t, node, val)
+	}
+}
+
+func TestQuoteMeta(t *testing.T) {
+	texts := []string{
+		"",
+		"plain text 123",
+		"1.5+2*3=?",
+		"\\.+*?()|[]{}^$",
+		"[a-z]{2,3}",
+		"\\Q\\E",
+		"(?i)(?P<name>x)\\1",
+		"çok güzel! ¿qué?",
+		"tab\tnew\nline",
+	}
+	for _, text := range texts {
+		quoted := QuoteMeta(text)
+		node, err := Parse(quoted)
+		if err != nil {
+			t.Fatalf("Parse(QuoteMeta(%q)) failed: %v", text, err)
+		}
+		seq, ok := node.(*SequenceNode)
+		if !ok {
+			t.Fatalf("Parse(QuoteMeta(%q)) = %T, want *SequenceNode", text, node)
+		}
+		var chars []Node
+		for _, char := range text {
+			chars = append(chars, b.Lit(char))
+		}
+		testNode(t, seq, b.Seq(chars...))
+		if !MatchBacktrack(node, text) {
+			t.Errorf("QuoteMeta(%q) = %q does not match the text", text, quoted)
+		}
+	}
+}
+
+func TestParseFreeSpacing(t *testing.T) {
+	cases := []struct {
+		pattern string
+		flags   Flags
+		compact string
+	}{
+		{"a b  c", FreeSpacing, "abc"},
+		{"a+ | b {2,3} ?", FreeSpacing, "a+|b{2,3}?"},
+		{"(?x) a b", 0, "ab"},
+		{"a b(?x) c d", 0, "a bcd"},
+		{"(?x: a b ) c d", 0, "(?:ab) c d"},
+		{"(?x) a (?-x) b c", 0, "a b c"},
+		{"\\d+ # digits\n \\. # dot\n \\d+", FreeSpacing, "\\d+\\.\\d+"},
+		{"[ #] \\  \\#", FreeSpacing, "[ #] #"},
+		{"\\Q a b\\E c", FreeSpacing, " a bc"},
+		{"hostname \\s+ (?P<name> \\S+ ) # the name of the device", FreeSpacing, "hostname\\s+(?P<name>\\S+)"},
+		{"a#", FreeSpacing, "a"},
+	}
+	for _, c := range cases {
+		node, err := ParseWithFlags(c.pattern, c.flags)
+		if err != nil {
+			t.Fatalf("ParseWithFlags(%q) failed: %v", c.pattern, err)
+		}
+		expected, err := Parse(c.compact)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", c.compact, err)
+		}
+		testNode(t, node, expected)
+	}
+}
+
+func TestParseStackedQuantifiers(t *testing.T) {
+	cases := []struct {
+		pattern string
+		nested  string
+	}{
+		{"a**", "(?:a*)*"},
+		{"a+?*", "(?:a+?)*"},
+		{"a*+?", "(?:a*+)?"},
+		{"(ab){2}*?c", "(?:(ab){2})*?c"},
+		{"a?{2,}+", "(?:a?){2,}+"},
+	}
+	for _, c := range cases {
+		node, err := ParseWithFlags(c.pattern, StackedQuantifiers)
+		if err != nil {
+			t.Fatalf("ParseWithFlags(%q, StackedQuantifiers) failed: %v", c.pattern, err)
+		}
+		if got := Pattern(node); got != c.nested {
+			t.Errorf("ParseWithFlags(%q, StackedQuantifiers) = %s, want %s", c.pattern, got, c.nested)
+		}
+	}
+}
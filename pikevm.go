@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// thread is a position in the NFA together with the capture slots recorded on
+// the way there.
+type thread struct {
+	state *State
+	caps  []int
+}
+
+// FindSubmatch returns the leftmost-first match of n in input as byte offsets:
+// the start and end of the whole match followed by the start and end of each
+// capturing group, with -1 for groups that did not take part in the match. It
+// returns nil when there is no match.
+//
+// It runs the NFA as a Pike VM: all threads advance together one character at
+// a time and are kept in priority order, the order a backtracker would try
+// them in, so the match is the one FindBacktrack finds while the running time
+// stays linear in the length of the input.
+func FindSubmatch(n Nfa, input string) []int {
+	slots := captureSlots(n)
+	var matched []int
+	var threads []thread
+	visited := make(map[*State]bool)
+	for pos := 0; ; {
+		if matched == nil {
+			// a new thread starting here ranks below every thread that
+			// started earlier
+			caps := make([]int, slots)
+			for i := range caps {
+				caps[i] = -1
+			}
+			caps[0] = pos
+			threads = addThread(threads, n.Start, caps, input, pos, visited)
+		}
+		if len(threads) == 0 {
+			return matched
+		}
+
+		char, size := utf8.DecodeRuneInString(input[pos:])
+		var next []thread
+		nextVisited := make(map[*State]bool)
+		for _, th := range threads {
+			if th.state == n.Accept {
+				// the threads after this one have lower priority
+				matched = append([]int(nil), th.caps...)
+				matched[1] = pos
+				break
+			}
+			if size == 0 {
+				continue
+			}
+			for _, t := range th.state.Transitions {
+				if t.Consumes() && matchers[t.Type](t, char) {
+					next = addThread(next, t.State, th.caps, input, pos+size, nextVisited)
+				}
+			}
+		}
+		if size == 0 {
+			return matched
+		}
+		threads, visited = next, nextVisited
+		pos += size
+	}
+}
+
+// addThread appends the thread for state, followed by the threads reachable
+// from it without consuming input, in priority order. A state already added
+// at this position keeps its earlier, higher priority thread.
+func addThread(threads []thread, state *State, caps []int, input string, pos int, visited map[*State]bool) []thread {
+	if visited[state] {
+		return threads
+	}
+	visited[state] = true
+	threads = append(threads, thread{state: state, caps: caps})
+	for _, t := range state.Transitions {
+		switch t.Type {
+		case Save:
+			slot, _ := strconv.Atoi(t.Condition)
+			saved := append([]int(nil), caps...)
+			saved[slot] = pos
+			threads = addThread(threads, t.State, saved, input, pos, visited)
+		case Assert:
+			prev, next := surrounding(input, pos)
+			if assertionHolds(t.Condition, prev, next) {
+				threads = addThread(threads, t.State, caps, input, pos, visited)
+			}
+		}
+	}
+	for _, e := range state.Epsilon {
+		threads = addThread(threads, e, caps, input, pos, visited)
+	}
+	return threads
+}
+
+// captureSlots returns how many offsets a match of n records: two for the
+// whole match and two for every capturing group.
+func captureSlots(n Nfa) int {
+	// a group repeated {0} times leaves no Save transitions behind, but it
+	// still has its slots
+	slots := max(2, 2*len(n.names))
+	for _, s := range n.States() {
+		for _, t := range s.Transitions {
+			if t.Type != Save {
+				continue
+			}
+			if slot, _ := strconv.Atoi(t.Condition); slot >= slots {
+				slots = slot + 1
+			}
+		}
+	}
+	if slots%2 == 1 {
+		slots++
+	}
+	return slots
+}
+
+// FindNamed returns the text of the named groups in the match FindSubmatch
+// finds, keyed by group name. Groups that did not take part in the match are
+// left out; the result is nil when there is no match.
+func FindNamed(n Nfa, input string) map[string]string {
+	return namedGroups(n.SubexpNames(), FindSubmatch(n, input), input)
+}
+
+func namedGroups(names []string, match []int, input string) map[string]string {
+	if match == nil {
+		return nil
+	}
+	groups := make(map[string]string)
+	for i, name := range names {
+		if name != "" && 2*i+1 < len(match) && match[2*i] >= 0 {
+			groups[name] = input[match[2*i]:match[2*i+1]]
+		}
+	}
+	return groups
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Pattern prints node back as a pattern in the default syntax. The result
+// uses as few parentheses and escapes as it can, and parsing it gives back
+// node for any node the parser built; flags that only show in the AST, such
+// as FoldCase on literals, are written as (?i) and (?-i) where they change.
+//
+// Nodes the parser never builds still print as an equivalent pattern, though
+// not always one that parses to the same tree: a quantified sequence gets a
+// (?:...) group, for instance.
+func Pattern(node Node) string {
+	var p printer
+	p.print(node)
+	return p.String()
+}
+
+// printer writes a pattern while keeping track of the flags in effect at the
+// end of it, the same way the parser does when reading it back.
+type printer struct {
+	strings.Builder
+	flags Flags
+}
+
+func (p *printer) print(node Node) {
+	switch n := node.(type) {
+	case *SequenceNode:
+		for _, child := range n.Children {
+			if _, ok := child.(*AlternationNode); ok {
+				p.enclose("(?:", child)
+			} else {
+				p.print(child)
+			}
+		}
+	case *AlternationNode:
+		for i, alt := range n.Alternatives {
+			if i > 0 {
+				p.WriteString("|")
+			}
+			p.print(alt)
+		}
+	case *LiteralNode:
+		p.setFlag(FoldCase, n.FoldCase)
+		p.WriteString(escapeLiteral(n.Value, metaChars))
+	case *MetaCharacterNode:
+		if _, ok := namedClass(n.Value); ok {
+			p.setFlag(FoldCase, n.FoldCase)
+		}
+		switch {
+		case n.Value == DOT || n.Value == ANY_CHAR:
+			p.setFlag(DotAll, n.Value == ANY_CHAR)
+			p.WriteString(".")
+		case posixClasses[n.Value] != nil:
+			// a POSIX class only exists inside brackets
+			p.WriteString("[" + n.Value + "]")
+		default:
+			p.WriteString(n.Value)
+		}
+	case *AssertionNode:
+		switch n.Value {
+		case CARET, BEGIN_LINE:
+			p.setFlag(MultiLine, n.Value == BEGIN_LINE)
+			p.WriteString("^")
+		case DOLLAR, END_LINE:
+			p.setFlag(MultiLine, n.Value == END_LINE)
+			p.WriteString("$")
+		default:
+			p.WriteString(n.Value)
+		}
+	case *BackreferenceNode:
+		p.setFlag(FoldCase, n.FoldCase)
+		fmt.Fprintf(p, "\\%d", n.Index)
+	case *CharList:
+		p.printCharList(n)
+	case *StarNode:
+		p.printQuantifier(n.Child, "*", n.Lazy, n.Possessive)
+	case *PlusNode:
+		p.printQuantifier(n.Child, "+", n.Lazy, n.Possessive)
+	case *QuestionNode:
+		p.printQuantifier(n.Child, "?", n.Lazy, n.Possessive)
+	case *RepeatNode:
+		bounds := fmt.Sprintf("{%d,%d}", n.Min, n.Max)
+		if n.Min == n.Max {
+			bounds = fmt.Sprintf("{%d}", n.Min)
+		} else if n.Max == -1 {
+			bounds = fmt.Sprintf("{%d,}", n.Min)
+		}
+		p.printQuantifier(n.Child, bounds, n.Lazy, n.Possessive)
+	case *GroupNode:
+		switch {
+		case n.Name != "":
+			p.enclose("(?P<"+n.Name+">", n.Child)
+		case n.Index > 0:
+			p.enclose("(", n.Child)
+		default:
+			p.enclose("(?:", n.Child)
+		}
+	case *AtomicNode:
+		p.enclose("(?>", n.Child)
+	case *LookaroundNode:
+		prefix := "(?"
+		if n.Behind {
+			prefix += "<"
+		}
+		if n.Negated {
+			prefix += "!"
+		} else {
+			prefix += "="
+		}
+		p.enclose(prefix, n.Child)
+	default:
+		p.WriteString(node.String())
+	}
+}
+
+// enclose prints child inside parentheses opened with prefix. Like the
+// parser, it forgets the flags set inside once they are closed.
+func (p *printer) enclose(prefix string, child Node) {
+	flags := p.flags
+	p.WriteString(prefix)
+	p.print(child)
+	p.WriteString(")")
+	p.flags = flags
+}
+
+// printQuantifier prints child followed by the operator, grouping the child
+// when it is more than a single factor.
+func (p *printer) printQuantifier(child Node, operator string, lazy, possessive bool) {
+	for {
+		seq, ok := child.(*SequenceNode)
+		if !ok || len(seq.Children) != 1 {
+			break
+		}
+		child = seq.Children[0]
+	}
+	switch child.(type) {
+	case *SequenceNode, *AlternationNode, *StarNode, *PlusNode, *QuestionNode, *RepeatNode:
+		p.enclose("(?:", child)
+	default:
+		p.print(child)
+	}
+	p.WriteString(operator + quantifierSuffix(lazy, possessive))
+}
+
+func (p *printer) printCharList(n *CharList) {
+	for _, char := range n.Chars {
+		// the parser gives every literal and range of a list the same flag
+		if literal, ok := char.(*LiteralNode); ok {
+			p.setFlag(FoldCase, literal.FoldCase)
+			break
+		}
+		if r, ok := char.(*RangeNode); ok {
+			p.setFlag(FoldCase, r.FoldCase)
+			break
+		}
+		if meta, ok := char.(*MetaCharacterNode); ok {
+			if _, named := namedClass(meta.Value); named {
+				p.setFlag(FoldCase, meta.FoldCase)
+				break
+			}
+		}
+	}
+	p.WriteString("[")
+	if n.Negated {
+		p.WriteString("^")
+	}
+	for i, char := range n.Chars {
+		// ^ is only special first and - anywhere but last, where it cannot
+		// make a range
+		special := `\[].`
+		if i == 0 && !n.Negated {
+			special += "^"
+		}
+		switch c := char.(type) {
+		case *LiteralNode:
+			if i < len(n.Chars)-1 {
+				special += "-"
+			}
+			p.WriteString(escapeLiteral(c.Value, special))
+		case *RangeNode:
+			special += "-"
+			p.WriteString(escapeLiteral(c.From, special) + "-" + escapeLiteral(c.To, special))
+		default:
+			p.WriteString(char.String())
+		}
+	}
+	p.WriteString("]")
+}
+
+// setFlag writes the group that turns flag on or off, unless it already is.
+func (p *printer) setFlag(flag Flags, on bool) {
+	if (p.flags&flag != 0) == on {
+		return
+	}
+	for letter, f := range groupFlags {
+		if f != flag {
+			continue
+		}
+		if on {
+			p.flags |= flag
+			p.WriteString("(?" + string(letter) + ")")
+		} else {
+			p.flags &^= flag
+			p.WriteString("(?-" + string(letter) + ")")
+		}
+	}
+}
+
+// escapeLiteral returns char so that it reads back as a literal: with a
+// backslash when it is one of special, as an escape sequence when it is not
+// printable and as itself otherwise.
+func escapeLiteral(char rune, special string) string {
+	switch {
+	case strings.ContainsRune(special, char):
+		return `\` + string(char)
+	case char == '\t':
+		return `\t`
+	case char == '\n':
+		return `\n`
+	case char == '\r':
+		return `\r`
+	case char == '\f':
+		return `\f`
+	case char == '\v':
+		return `\v`
+	case !unicode.IsPrint(char) && char <= 0xff:
+		return fmt.Sprintf(`\x%02x`, char)
+	}
+	return string(char)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPattern(t *testing.T) {
+	cases := map[string]string{
+		"":                     "",
+		"ab|c|":                "ab|c|",
+		"a.b\\.\\*\\(\\{":      "a.b\\.\\*\\(\\{",
+		"a{2,2}b{1,}c{1,3}?":   "a{2}b{1,}c{1,3}?",
+		"\\pL\\P{Greek}\\d":    "\\p{L}\\P{Greek}\\d",
+		"(a)(?:b)(?P<n>c)":     "(a)(?:b)(?P<n>c)",
+		"(?<n>c)\\1":           "(?P<n>c)\\1",
+		"(?=a)(?<!b)(?>c)":     "(?=a)(?<!b)(?>c)",
+		"(?i)ab(?-i)c":         "(?i)ab(?-i)c",
+		"(?i:ab)c":             "(?:(?i)ab)c",
+		"(?i)a|b":              "(?i)a|b",
+		"(?s).(?-s).":          "(?s).(?-s).",
+		"(?m)^a$":              "(?m)^a$",
+		"[^^a-z\\d.\\.\\]-]":   "[^^a-z\\d.\\.\\]-]",
+		"[\\^\\-a]":            "[\\^\\-a]",
+		"[[:alpha:]_]":         "[[:alpha:]_]",
+		"(?i)[a-c]x":           "(?i)[a-c]x",
+		"(?i)[\\d[:upper:]]":   "(?i)[\\d[:upper:]]",
+		"(?i)\\p{Lu}(?-i)\\pL": "(?i)\\p{Lu}(?-i)\\p{L}",
+		"\\t\\x00\\xe9é ":      "\\t\\x00éé ",
+		"\\Q1+1\\E":            "1\\+1",
+		"(?x) a (?-x) b":       "a b",
+		"a*?b++c??(?:de)*":     "a*?b++c??(?:de)*",
+		"\\b\\B\\A\\z^*":       "\\b\\B\\A\\z^*",
+		"(a|b(c|d))*":          "(a|b(c|d))*",
+		"(?i)(a)(?-i)\\1":      "((?i)a)\\1",
+		"((?i)a)b":             "((?i)a)b",
+		"(?s:(?m:.^).)$.":      "(?:(?:(?s).(?m)^)(?s).)$.",
+	}
+	for pattern, want := range cases {
+		ast, err := Parse(pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", pattern, err)
+		}
+		if got := Pattern(ast); got != want {
+			t.Errorf("Pattern(Parse(%q)) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestPatternBuiltNodes(t *testing.T) {
+	cases := []struct {
+		node Node
+		want string
+	}{
+		{b.Star(b.Seq(b.Lit('a'), b.Lit('b'))), "(?:ab)*"},
+		{b.Plus(b.Seq(b.Lit('a'))), "a+"},
+		{b.Question(b.Star(b.Lit('a'))), "(?:a*)?"},
+		{b.Repeat(b.Alt(b.Lit('a'), b.Lit('b')), 2, 3), "(?:a|b){2,3}"},
+		{b.Seq(b.Alt(b.Lit('a'), b.Lit('b')), b.Lit('c')), "(?:a|b)c"},
+		{b.Seq(b.Seq(b.Lit('a'), b.Lit('b')), b.Lit('c')), "abc"},
+		{b.Meta("[:digit:]"), "[[:digit:]]"},
+		{b.Star(b.Seq()), "(?:)*"},
+	}
+	for _, c := range cases {
+		if got := Pattern(c.node); got != c.want {
+			t.Errorf("Pattern(%s) = %q, want %q", c.node, got, c.want)
+		}
+	}
+}
+
+func TestPatternRoundTrip(t *testing.T) {
+	grammar, err := Grammar()
+	if err != nil {
+		t.Fatalf("Grammar failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		pattern, err := RandomPattern(grammar, r, 10)
+		if err != nil {
+			t.Fatalf("RandomPattern failed: %v", err)
+		}
+		ast, err := Parse(pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", pattern, err)
+		}
+		printed := Pattern(ast)
+		reparsed, err := Parse(printed)
+		if err != nil {
+			t.Fatalf("Parse(Pattern(Parse(%q))) = Parse(%q) failed: %v", pattern, printed, err)
+		}
+		if !reflect.DeepEqual(reparsed, ast) {
+			t.Fatalf("Parse(Pattern(Parse(%q))) = Parse(%q) is a different tree", pattern, printed)
+		}
+		if again := Pattern(reparsed); again != printed {
+			t.Fatalf("Pattern is not stable for %q: %q, then %q", pattern, printed, again)
+		}
+	}
+}
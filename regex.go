@@ -1,14 +1,29 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"slices"
+	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-func Compile(n Node) Nfa {
+// ErrNotSupported is returned by Compile for patterns that use features only
+// the backtracking engine can match: backreferences, lookarounds, atomic
+// groups and possessive quantifiers.
+var ErrNotSupported = errors.New("not supported by automata engine")
+
+// MaxRepeatStates caps the number of NFA states a counted repetition such as
+// a{2,100} is allowed to expand into.
+var MaxRepeatStates = 10000
+
+func Compile(n Node) (Nfa, error) {
 	initMatchers()
-	return compileNode(n)
+	nfa, err := compileNode(n)
+	nfa.names = SubexpNames(n)
+	return nfa, err
 }
 
 type matcherFunc func(t Transition, char rune) bool
@@ -17,71 +32,246 @@ var matchers map[TransitionType]matcherFunc
 
 func initMatchers() {
 	matchers = map[TransitionType]matcherFunc{
-		Literal: matchLiteral,
-		Meta:    matchMeta,
+		Literal:      matchLiteral,
+		Meta:         matchMeta,
+		Range:        matchRange,
+		NegatedClass: matchNegatedClass,
 	}
 }
 
-func compileNode(n Node) Nfa {
+func compileNode(n Node) (Nfa, error) {
+	switch n.(type) {
+	case *StarNode, *PlusNode, *QuestionNode, *RepeatNode:
+		if repetition(n).possessive {
+			return Nfa{}, fmt.Errorf("possessive quantifier %s: %w", Pattern(n), ErrNotSupported)
+		}
+	}
 	switch n := n.(type) {
 	case *LiteralNode:
-		return compileLiteral(n)
+		return compileLiteral(n), nil
 	case *SequenceNode:
 		return compileSequence(n)
 	case *StarNode:
 		return compileStar(n)
+	case *PlusNode:
+		return compilePlus(n)
+	case *QuestionNode:
+		return compileQuestion(n)
+	case *RepeatNode:
+		return compileRepeat(n)
 	case *CharList:
-		return compileCharList(n)
+		return compileCharList(n), nil
 	case *MetaCharacterNode:
-		return compileMetaCharacter(n)
+		return compileMetaCharacter(n), nil
+	case *AssertionNode:
+		return compileAssertion(n), nil
+	case *AlternationNode:
+		return compileAlternation(n)
+	case *GroupNode:
+		return compileGroup(n)
+	case *BackreferenceNode:
+		return Nfa{}, fmt.Errorf("backreference %s: %w", n.String(), ErrNotSupported)
+	case *LookaroundNode:
+		// the NFA only knows the current character, it cannot run a
+		// sub-match ahead of or behind it
+		return Nfa{}, fmt.Errorf("lookaround %s: %w", Pattern(n), ErrNotSupported)
+	case *AtomicNode:
+		// all the threads run at once, there is no backtracking to cut
+		return Nfa{}, fmt.Errorf("atomic group %s: %w", Pattern(n), ErrNotSupported)
 	default:
-		panic(fmt.Sprintf("Unknown node type %T", n))
+		return Nfa{}, fmt.Errorf("%T: %w", n, ErrNotSupported)
 	}
 }
 
 func compileLiteral(n *LiteralNode) Nfa {
 	nfa := NewNfa()
-	nfa.Start.AddTransition(Literal, string(n.Value), nfa.Accept)
+	t := charTransition(n)
+	t.State = nfa.Accept
+	nfa.Start.Transitions = append(nfa.Start.Transitions, t)
 	return nfa
 }
 
 func compileMetaCharacter(n *MetaCharacterNode) Nfa {
 	nfa := NewNfa()
-	nfa.Start.AddTransition(Meta, n.Value, nfa.Accept)
+	t := charTransition(n)
+	t.State = nfa.Accept
+	nfa.Start.Transitions = append(nfa.Start.Transitions, t)
 	return nfa
 }
 
-func compileSequence(n *SequenceNode) Nfa {
-	nfa := compileNode(n.Children[0])
+func compileAssertion(n *AssertionNode) Nfa {
+	nfa := NewNfa()
+	nfa.Start.AddTransition(Assert, n.Value, nfa.Accept)
+	return nfa
+}
+
+func compileSequence(n *SequenceNode) (Nfa, error) {
+	if len(n.Children) == 0 {
+		nfa := NewNfa()
+		nfa.Start.AddEpsilonTo(nfa.Accept)
+		return nfa, nil
+	}
+	nfa, err := compileNode(n.Children[0])
+	if err != nil {
+		return Nfa{}, err
+	}
 	for i := 1; i < len(n.Children); i++ {
-		childNfa := compileNode(n.Children[i])
+		childNfa, err := compileNode(n.Children[i])
+		if err != nil {
+			return Nfa{}, err
+		}
 		nfa = concat(nfa, childNfa)
 	}
-	return nfa
+	return nfa, nil
+}
+
+func compileAlternation(n *AlternationNode) (Nfa, error) {
+	nfa, err := compileNode(n.Alternatives[0])
+	if err != nil {
+		return Nfa{}, err
+	}
+	for i := 1; i < len(n.Alternatives); i++ {
+		altNfa, err := compileNode(n.Alternatives[i])
+		if err != nil {
+			return Nfa{}, err
+		}
+		nfa = union(nfa, altNfa)
+	}
+	return nfa, nil
 }
 
-func compileStar(n *StarNode) Nfa {
+func compileStar(n *StarNode) (Nfa, error) {
 	nfa := NewNfa()
-	childNfa := compileNode(n.Child)
-	// TODO: changing the order of following epsilon transitions breaks the encoding
+	childNfa, err := compileNode(n.Child)
+	if err != nil {
+		return Nfa{}, err
+	}
+	// epsilon moves are listed by priority, so the greedy star prefers
+	// another iteration over leaving the loop and the lazy one the opposite
+	addEpsilons(nfa.Start, n.Lazy, childNfa.Start, nfa.Accept)
+	addEpsilons(childNfa.Accept, n.Lazy, childNfa.Start, nfa.Accept)
+	return nfa, nil
+}
+
+func compilePlus(n *PlusNode) (Nfa, error) {
+	nfa := NewNfa()
+	childNfa, err := compileNode(n.Child)
+	if err != nil {
+		return Nfa{}, err
+	}
 	nfa.Start.AddEpsilonTo(childNfa.Start)
-	nfa.Start.AddEpsilonTo(nfa.Accept)
+	addEpsilons(childNfa.Accept, n.Lazy, childNfa.Start, nfa.Accept)
+	return nfa, nil
+}
+
+func compileQuestion(n *QuestionNode) (Nfa, error) {
+	nfa := NewNfa()
+	childNfa, err := compileNode(n.Child)
+	if err != nil {
+		return Nfa{}, err
+	}
+	addEpsilons(nfa.Start, n.Lazy, childNfa.Start, nfa.Accept)
 	childNfa.Accept.AddEpsilonTo(nfa.Accept)
-	childNfa.Accept.AddEpsilonTo(childNfa.Start)
-	return nfa
+	return nfa, nil
 }
 
-func compileCharList(n *CharList) Nfa {
-	var charListNfa Nfa
-	for _, node := range n.Chars {
-		if charListNfa == (Nfa{}) {
-			charListNfa = compileNode(node)
+// addEpsilons adds epsilon moves from s to more, another iteration, and to
+// done, the way out, with the iteration first unless lazy is set.
+func addEpsilons(s *State, lazy bool, more *State, done *State) {
+	if lazy {
+		s.AddEpsilonTo(done)
+		s.AddEpsilonTo(more)
+	} else {
+		s.AddEpsilonTo(more)
+		s.AddEpsilonTo(done)
+	}
+}
+
+// compileGroup surrounds a capturing group with Save transitions recording
+// where it starts and ends in slots 2*Index and 2*Index+1.
+func compileGroup(n *GroupNode) (Nfa, error) {
+	childNfa, err := compileNode(n.Child)
+	if err != nil || n.Index == 0 {
+		return childNfa, err
+	}
+	nfa := NewNfa()
+	nfa.Start.AddTransition(Save, strconv.Itoa(2*n.Index), childNfa.Start)
+	childNfa.Accept.AddTransition(Save, strconv.Itoa(2*n.Index+1), nfa.Accept)
+	return nfa, nil
+}
+
+// compileRepeat expands a counted repetition into copies of its child, so
+// x{2,4} is compiled like xx(x(x)?)? and x{2,} like xxx*.
+func compileRepeat(n *RepeatNode) (Nfa, error) {
+	childNfa, err := compileNode(n.Child)
+	if err != nil {
+		return Nfa{}, err
+	}
+	copies := max(n.Min, n.Max)
+	if n.Max == -1 {
+		copies = n.Min + 1
+	}
+	// compared by division so that large counts cannot overflow
+	if copies > MaxRepeatStates/len(childNfa.States()) {
+		return Nfa{}, fmt.Errorf("repetition %s expands to more than %d states", Pattern(n), MaxRepeatStates)
+	}
+	return compileNode(expandRepeat(n))
+}
+
+func expandRepeat(n *RepeatNode) Node {
+	sequence := &SequenceNode{}
+	for i := 0; i < n.Min; i++ {
+		sequence.Children = append(sequence.Children, n.Child)
+	}
+	if n.Max == -1 {
+		sequence.Children = append(sequence.Children, &StarNode{Child: n.Child, Lazy: n.Lazy})
+		return sequence
+	}
+	var optional Node
+	for i := n.Min; i < n.Max; i++ {
+		if optional == nil {
+			optional = &QuestionNode{Child: n.Child, Lazy: n.Lazy}
 		} else {
-			nfa := compileNode(node)
-			charListNfa = union(charListNfa, nfa)
+			optional = &QuestionNode{Child: &SequenceNode{Children: []Node{n.Child, optional}}, Lazy: n.Lazy}
 		}
 	}
-	return charListNfa
+	if optional != nil {
+		sequence.Children = append(sequence.Children, optional)
+	}
+	return sequence
+}
+
+// compileCharList connects a single pair of states with one transition per
+// class member, or with one NegatedClass transition when the list is negated.
+func compileCharList(n *CharList) Nfa {
+	nfa := NewNfa()
+	if n.Negated {
+		t := Transition{Type: NegatedClass, Condition: n.String(), State: nfa.Accept}
+		for _, char := range n.Chars {
+			t.Items = append(t.Items, charTransition(char))
+		}
+		nfa.Start.Transitions = append(nfa.Start.Transitions, t)
+		return nfa
+	}
+	for _, char := range n.Chars {
+		t := charTransition(char)
+		t.State = nfa.Accept
+		nfa.Start.Transitions = append(nfa.Start.Transitions, t)
+	}
+	return nfa
+}
+
+func charTransition(n CharacterNode) Transition {
+	switch c := n.(type) {
+	case *LiteralNode:
+		return Transition{Type: Literal, Condition: string(c.Value), FoldCase: c.FoldCase}
+	case *RangeNode:
+		return Transition{Type: Range, Condition: c.String(), FoldCase: c.FoldCase}
+	case *MetaCharacterNode:
+		return Transition{Type: Meta, Condition: c.Value, FoldCase: c.FoldCase}
+	default:
+		return Transition{Type: Meta, Condition: c.GetValue()}
+	}
 }
 
 func union(n1 Nfa, n2 Nfa) Nfa {
@@ -104,40 +294,201 @@ func concat(n1 Nfa, n2 Nfa) Nfa {
 }
 
 func matchLiteral(t Transition, char rune) bool {
+	if t.FoldCase {
+		value, _ := utf8.DecodeRuneInString(t.Condition)
+		return equalFold(value, char)
+	}
 	return t.Condition == string(char)
 }
 
+func matchRange(t Transition, char rune) bool {
+	bounds := []rune(t.Condition)
+	return inRange(bounds[0], bounds[2], char, t.FoldCase)
+}
+
+// equalFold reports whether a and b are the same character under Unicode
+// simple case folding, so 'k', 'K' and the Kelvin sign are all equal.
+func equalFold(a, b rune) bool {
+	for f := a; ; {
+		if f == b {
+			return true
+		}
+		if f = unicode.SimpleFold(f); f == a {
+			return false
+		}
+	}
+}
+
+// inRange reports whether char is between from and to; with fold, any case
+// of char being in the range is enough.
+func inRange(from, to, char rune, fold bool) bool {
+	for f := char; ; {
+		if from <= f && f <= to {
+			return true
+		}
+		if f = unicode.SimpleFold(f); !fold || f == char {
+			return false
+		}
+	}
+}
+
+func matchNegatedClass(t Transition, char rune) bool {
+	for _, item := range t.Items {
+		if matchers[item.Type](item, char) {
+			return false
+		}
+	}
+	return true
+}
+
+// posixClasses are the named classes that can appear as [:name:] inside a
+// bracket expression, keyed by the meta character value the parser produces.
+var posixClasses = map[string]func(char rune) bool{
+	"[:alnum:]":  func(c rune) bool { return isPosixAlpha(c) || isPosixDigit(c) },
+	"[:alpha:]":  isPosixAlpha,
+	"[:blank:]":  func(c rune) bool { return c == ' ' || c == '\t' },
+	"[:cntrl:]":  func(c rune) bool { return c < ' ' || c == 0x7f },
+	"[:digit:]":  isPosixDigit,
+	"[:graph:]":  func(c rune) bool { return '!' <= c && c <= '~' },
+	"[:lower:]":  func(c rune) bool { return 'a' <= c && c <= 'z' },
+	"[:print:]":  func(c rune) bool { return ' ' <= c && c <= '~' },
+	"[:punct:]":  func(c rune) bool { return '!' <= c && c <= '~' && !isPosixAlpha(c) && !isPosixDigit(c) },
+	"[:space:]":  func(c rune) bool { return c == ' ' || ('\t' <= c && c <= '\r') },
+	"[:upper:]":  func(c rune) bool { return 'A' <= c && c <= 'Z' },
+	"[:xdigit:]": func(c rune) bool { return isPosixDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F') },
+}
+
+// namedClass returns the predicate of a class the parser refers to by name:
+// a POSIX class such as [:alpha:] or a Unicode general category or script
+// such as \p{L}, \p{Greek} or its negation \P{Greek}.
+func namedClass(value string) (func(char rune) bool, bool) {
+	if class, ok := posixClasses[value]; ok {
+		return class, true
+	}
+	if len(value) < 5 || value[0] != '\\' || (value[1] != 'p' && value[1] != 'P') || value[2] != '{' || value[len(value)-1] != '}' {
+		return nil, false
+	}
+	name := value[3 : len(value)-1]
+	table, ok := unicode.Categories[name]
+	if !ok {
+		table, ok = unicode.Scripts[name]
+	}
+	if !ok {
+		return nil, false
+	}
+	negated := value[1] == 'P'
+	return func(char rune) bool {
+		return unicode.Is(table, char) != negated
+	}, true
+}
+
+// inNamedClass reports whether char is in the named class value. With fold
+// the class holds every case of its characters before a \P negates it, so
+// (?i)\p{Lu} matches 'a' and (?i)\P{Lu} matches neither 'a' nor 'A'.
+func inNamedClass(value string, char rune, fold bool) bool {
+	negated := strings.HasPrefix(value, "\\P")
+	if negated {
+		value = "\\p" + value[2:]
+	}
+	class, ok := namedClass(value)
+	if !ok {
+		return false
+	}
+	for f := char; ; {
+		if class(f) {
+			return !negated
+		}
+		if f = unicode.SimpleFold(f); !fold || f == char {
+			return negated
+		}
+	}
+}
+
+func isPosixAlpha(c rune) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isPosixDigit(c rune) bool {
+	return '0' <= c && c <= '9'
+}
+
 func matchMeta(t Transition, char rune) bool {
+	if _, ok := namedClass(t.Condition); ok {
+		return inNamedClass(t.Condition, char, t.FoldCase)
+	}
 	if t.Condition == DOT {
+		return char != '\n'
+	} else if t.Condition == ANY_CHAR {
 		return true
 	} else if t.Condition == WHITESPACE {
 		return unicode.IsSpace(char)
 	} else if t.Condition == NONWHITESPACE {
-		switch char {
-		case ' ', '\t', '\n', '\r', '\f', '\v':
-			return false
-		default:
-			return true
-		}
+		return !unicode.IsSpace(char)
+	} else if t.Condition == DIGIT {
+		return '0' <= char && char <= '9'
+	} else if t.Condition == NONDIGIT {
+		return char < '0' || '9' < char
+	} else if t.Condition == WORD {
+		return isWordChar(char)
+	} else if t.Condition == NONWORD {
+		return !isWordChar(char)
 	}
 	return false
 }
 
+// assertionHolds evaluates a zero-width assertion between the characters prev
+// and next, either of which is -1 at the edges of the input.
+func assertionHolds(condition string, prev rune, next rune) bool {
+	switch condition {
+	case CARET, BEGIN_TEXT:
+		return prev == -1
+	case DOLLAR, END_TEXT:
+		return next == -1
+	case BEGIN_LINE:
+		return prev == -1 || prev == '\n'
+	case END_LINE:
+		return next == -1 || next == '\n'
+	case WORD_BOUNDARY:
+		return isWordChar(prev) != isWordChar(next)
+	case NON_WORD_BOUNDARY:
+		return isWordChar(prev) == isWordChar(next)
+	}
+	return false
+}
+
+func isWordChar(char rune) bool {
+	return char == '_' || ('0' <= char && char <= '9') || ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z')
+}
+
+// surrounding returns the characters before and after the byte offset pos,
+// using -1 where pos is at the start or the end of the input.
+func surrounding(input string, pos int) (rune, rune) {
+	prev, next := rune(-1), rune(-1)
+	if pos > 0 {
+		prev, _ = utf8.DecodeLastRuneInString(input[:pos])
+	}
+	if pos < len(input) {
+		next, _ = utf8.DecodeRuneInString(input[pos:])
+	}
+	return prev, next
+}
+
 func Match(n Nfa, input string) bool {
-	states := closures(n.Start)
+	states := closures(n.Start, input, 0)
 	for i, char := range input {
 		fmt.Printf("checking character %d=%s\n", i, string(char))
+		_, size := utf8.DecodeRuneInString(input[i:])
 		var nextStates []*State
 		visited := make(map[*State]bool)
 		for _, s := range states {
 			var targetStates []*State
 			for _, t := range s.Transitions {
-				if matchers[t.Type](t, char) {
+				if t.Consumes() && matchers[t.Type](t, char) {
 					targetStates = append(targetStates, t.State)
 				}
 			}
 			for _, ts := range targetStates {
-				closureStates := closures(ts)
+				closureStates := closures(ts, input, i+size)
 				for _, c := range closureStates {
 					if visited[c] == false {
 						visited[c] = true
@@ -155,20 +506,21 @@ func Match(n Nfa, input string) bool {
 }
 
 func matchFrom (n Nfa, input string) bool {
-	states := closures(n.Start)
+	states := closures(n.Start, input, 0)
 	for i, char := range input {
 		fmt.Printf("checking character %d=%s\n", i, string(char))
+		_, size := utf8.DecodeRuneInString(input[i:])
 		var nextStates []*State
 		visited := make(map[*State]bool)
 		for _, s := range states {
 			var targetStates []*State
 			for _, t := range s.Transitions {
-				if matchers[t.Type](t, char) {
+				if t.Consumes() && matchers[t.Type](t, char) {
 					targetStates = append(targetStates, t.State)
 				}
 			}
 			for _, ts := range targetStates {
-				closureStates := closures(ts)
+				closureStates := closures(ts, input, i+size)
 				for _, c := range closureStates {
 					if visited[c] == false {
 						visited[c] = true
@@ -190,8 +542,8 @@ func matchFrom (n Nfa, input string) bool {
 
 func MatchPartial(nfa Nfa, fullInput string) bool {
 	var b NodeBuilder
-	ast := b.Seq(b.Star(b.Meta(DOT)))
-	startNfa := Compile(ast)
+	ast := b.Seq(b.Star(b.Meta(ANY_CHAR)))
+	startNfa, _ := Compile(ast)
 	n := concat(startNfa,nfa)
 		if matchFrom(n, fullInput) {
 			return true
@@ -199,13 +551,77 @@ func MatchPartial(nfa Nfa, fullInput string) bool {
 	return false
 }
 
-func closures(n *State) []*State {
+// FindLongest returns the byte offsets [start, end] of the leftmost-longest
+// match of n in input, the rule POSIX prescribes: the earliest starting match
+// wins and among those the longest one, regardless of the order of
+// alternatives. It returns nil when there is no match.
+func FindLongest(n Nfa, input string) []int {
+	var match []int
+	var states []*State
+	starts := make(map[*State]int)
+	for pos := 0; ; {
+		if match == nil {
+			for _, s := range closures(n.Start, input, pos) {
+				if _, ok := starts[s]; !ok {
+					starts[s] = pos
+					states = append(states, s)
+				}
+			}
+		}
+		if start, ok := starts[n.Accept]; ok {
+			if match == nil || start < match[0] || (start == match[0] && pos > match[1]) {
+				match = []int{start, pos}
+			}
+		}
+		if pos == len(input) || (match != nil && len(states) == 0) {
+			return match
+		}
+
+		char, size := utf8.DecodeRuneInString(input[pos:])
+		var nextStates []*State
+		nextStarts := make(map[*State]int)
+		for _, s := range states {
+			start := starts[s]
+			if match != nil && start > match[0] {
+				continue
+			}
+			for _, t := range s.Transitions {
+				if !t.Consumes() || !matchers[t.Type](t, char) {
+					continue
+				}
+				for _, c := range closures(t.State, input, pos+size) {
+					previous, ok := nextStarts[c]
+					if !ok {
+						nextStates = append(nextStates, c)
+					}
+					if !ok || start < previous {
+						nextStarts[c] = start
+					}
+				}
+			}
+		}
+		states, starts = nextStates, nextStarts
+		pos += size
+	}
+}
+
+// closures returns the states reachable from n without consuming input at
+// byte offset pos, following epsilon moves, save points and the assertions
+// that hold there.
+func closures(n *State, input string, pos int) []*State {
 	var states []*State
+	prev, next := surrounding(input, pos)
 
 	var findClosures func(childState *State)
 	findClosures = func(childState *State) {
-		if slices.Contains(states, childState) == false {
-			states = append(states, childState)
+		if slices.Contains(states, childState) {
+			return
+		}
+		states = append(states, childState)
+		for _, t := range childState.Transitions {
+			if t.Type == Save || t.Type == Assert && assertionHolds(t.Condition, prev, next) {
+				findClosures(t.State)
+			}
 		}
 		for _, epsilonState := range childState.Epsilon {
 			findClosures(epsilonState)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"testing"
 )
 
@@ -11,7 +12,10 @@ func TestRegexPerformanceBacktrack(t *testing.T) {
 	l := New(pattern)
 	parser := NewParser(l)
 	ast := parser.Ast()
-	nfa := Compile(ast)
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 	str := nfa.ToDigraph()
 	fmt.Println(str)
 	if got := MatchBacktrack(ast, config); got != true {
@@ -25,7 +29,10 @@ func TestRegexPerformancePartialBacktrack(t *testing.T) {
 	l := New(pattern)
 	parser := NewParser(l)
 	ast := parser.Ast()
-	nfa := Compile(ast)
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 	str := nfa.ToDigraph()
 	fmt.Println(str)
 	if got := MatchBacktrackPartial(ast, allConfig); got != true {
@@ -245,6 +252,353 @@ func TestRegexMatchBacktrack(t *testing.T) {
 			{"aaaab", true},
 			{"aaaaaaab", true},
 		},
+		"foo|bar": {
+			{"foo", true},
+			{"bar", true},
+			{"fo", false},
+			{"foobar", false},
+			{"", false},
+		},
+		"a(b|c)d": {
+			{"abd", true},
+			{"acd", true},
+			{"ad", false},
+			{"abcd", false},
+		},
+		"(ab)*c": {
+			{"c", true},
+			{"abc", true},
+			{"ababc", true},
+			{"abac", false},
+			{"ab", false},
+		},
+		"(a|ab)(c|bcd)": {
+			{"ac", true},
+			{"abcd", true},
+			{"abc", true},
+			{"abd", false},
+		},
+		"(a|ab)*c": {
+			{"abc", true},
+			{"aabac", true},
+			{"abbc", false},
+		},
+		"a(|b)c": {
+			{"ac", true},
+			{"abc", true},
+			{"abbc", false},
+		},
+		"ab+c": {
+			{"abc", true},
+			{"abbbc", true},
+			{"ac", false},
+			{"abbb", false},
+		},
+		"colou?r": {
+			{"color", true},
+			{"colour", true},
+			{"colouur", false},
+		},
+		"a{3}": {
+			{"aaa", true},
+			{"aa", false},
+			{"aaaa", false},
+		},
+		"a{2,}b": {
+			{"aab", true},
+			{"aaaaab", true},
+			{"ab", false},
+		},
+		"a{2,4}": {
+			{"a", false},
+			{"aa", true},
+			{"aaa", true},
+			{"aaaa", true},
+			{"aaaaa", false},
+		},
+		"(ab|c){2,3}d": {
+			{"abcd", true},
+			{"ccd", true},
+			{"ababcd", true},
+			{"cd", false},
+			{"ababccd", false},
+		},
+		"a{0}b": {
+			{"b", true},
+			{"ab", false},
+		},
+		"(a|)+b": {
+			{"b", true},
+			{"aab", true},
+		},
+		"a{,2}": {
+			{"a{,2}", true},
+			{"aa", false},
+		},
+		"[a-c]x": {
+			{"ax", true},
+			{"bx", true},
+			{"cx", true},
+			{"dx", false},
+			{"-x", false},
+		},
+		"[^a-c]x": {
+			{"dx", true},
+			{" x", true},
+			{"ax", false},
+			{"cx", false},
+			{"x", false},
+		},
+		"[^\\s]+": {
+			{"abc", true},
+			{"a c", false},
+		},
+		"[a-zA-Z_][a-zA-Z0-9_]*": {
+			{"x", true},
+			{"_Foo1", true},
+			{"1abc", false},
+			{"ab-c", false},
+		},
+		"[a-]+": {
+			{"a-a", true},
+			{"b", false},
+		},
+		"^ab$": {
+			{"ab", true},
+			{"abc", false},
+		},
+		"a\\bb": {
+			{"ab", false},
+		},
+		"\\bfoo\\b": {
+			{"foo", true},
+			{"foobar", false},
+		},
+		"a$b": {
+			{"ab", false},
+		},
+		"\\d+\\.\\d+": {
+			{"3.14", true},
+			{"3x14", false},
+			{"3.", false},
+		},
+		"\\w+\\W\\w+": {
+			{"foo_1 bar", true},
+			{"foo_1bar", false},
+		},
+		"\\D\\t\\x41": {
+			{"x\tA", true},
+			{"1\tA", false},
+		},
+		"a\\*b\\\\": {
+			{"a*b\\", true},
+			{"aab\\", false},
+		},
+		"\\[\\d{2}\\]": {
+			{"[42]", true},
+			{"42", false},
+		},
+		"[\\s\\S]\\S": {
+			{"\nx", true},
+			{"x ", false},
+		},
+		"héllo": {
+			{"héllo", true},
+			{"hello", false},
+			{"hélló", false},
+		},
+		"[α-ω]+": {
+			{"αβγ", true},
+			{"ω", true},
+			{"αbγ", false},
+			{"Ω", false},
+		},
+		"日本.語": {
+			{"日本の語", true},
+			{"日本語", false},
+		},
+		"[^é]x": {
+			{"ex", true},
+			{"éx", false},
+			{"ñx", true},
+		},
+		"\\w\\W\\S": {
+			{"a€ü", true},
+			{"é€ü", false},
+		},
+		"😀+\\s?": {
+			{"😀😀 ", true},
+			{"😀😀😀", true},
+			{"😃", false},
+		},
+		"[[:alpha:]_][[:alnum:]]*": {
+			{"_x9", true},
+			{"a", true},
+			{"9a", false},
+			{"é", false},
+		},
+		"[^[:digit:][:space:]]+": {
+			{"ab-c", true},
+			{"a b", false},
+			{"a1", false},
+		},
+		"[[:upper:][:punct:]][[:xdigit:]]": {
+			{"Af", true},
+			{"!0", true},
+			{"ag", false},
+			{"Ag", false},
+		},
+		"[[:blank:]][[:cntrl:]][[:graph:]][[:print:]][[:lower:]]": {
+			{"\t\n~ a", true},
+			{" \x7f!!z", true},
+			{"  ~ a", false},
+			{"\t\n \na", false},
+		},
+		"(?i)parent": {
+			{"Parent", true},
+			{"PARENT", true},
+			{"parents", false},
+		},
+		"a(?i)b|c": {
+			{"aB", true},
+			{"C", true},
+			{"AB", false},
+		},
+		"(?i:k)(?-i)k[a-c]": {
+			{"\u212akb", true},
+			{"KkC", false},
+			{"KKb", false},
+		},
+		"x(?i:[α-γ]+)x": {
+			{"xΑβΓx", true},
+			{"xΔx", false},
+			{"XαX", false},
+		},
+		"(?i)[^k]ß": {
+			{"aẞ", true},
+			{"\u212aß", false},
+		},
+		"a.b": {
+			{"a b", true},
+			{"a\nb", false},
+		},
+		"(?s)a.b": {
+			{"a\nb", true},
+			{"a\rb", true},
+		},
+		"(?s:a.)b.": {
+			{"a\nbc", true},
+			{"a\nb\n", false},
+		},
+		"a\n^b": {
+			{"a\nb", false},
+		},
+		"(?m)a$\n^b$": {
+			{"a\nb", true},
+			{"ab", false},
+		},
+		"(a+)b\\1": {
+			{"aabaa", true},
+			{"aaba", false},
+			{"abaa", false},
+		},
+		"(\\w+) \\1": {
+			{"hello hello", true},
+			{"hello world", false},
+		},
+		"(?i)(ab)\\1": {
+			{"abAB", true},
+			{"aBAb", true},
+			{"abac", false},
+		},
+		"(a)|b\\1": {
+			{"a", true},
+			{"b", false},
+		},
+		"(é)\\1{2}": {
+			{"ééé", true},
+			{"éé", false},
+		},
+		"^(?=.*\\d)\\D.*$": {
+			{"a1", true},
+			{"abc9def", true},
+			{"1abc", false},
+			{"abc", false},
+		},
+		"(?!un)\\w+able": {
+			{"readable", true},
+			{"unreadable", false},
+		},
+		"\\w+(?<=ing)": {
+			{"going", true},
+			{"gone", false},
+		},
+		"(?<!é)x": {
+			{"x", true},
+		},
+		"a(?<!é)x": {
+			{"ax", true},
+		},
+		"é(?<!é)x": {
+			{"éx", false},
+		},
+		"(?=(\\w+))\\1!": {
+			{"abc!", true},
+			{"abc", false},
+		},
+		"(?:(?!(a))|a)\\1": {
+			{"aa", false},
+		},
+		"(?:(?=(a))b|a)\\1": {
+			{"aa", false},
+			{"ab", false},
+		},
+		"a*+a": {
+			{"aaa", false},
+			{"", false},
+		},
+		"a++b": {
+			{"aab", true},
+			{"b", false},
+		},
+		"\\w?+\\w": {
+			{"ab", true},
+			{"a", false},
+		},
+		"(ab){1,2}+b": {
+			{"ababb", true},
+			{"abab", false},
+		},
+		"(?>a|ab)c": {
+			{"ac", true},
+			{"abc", false},
+		},
+		"(?>(a+)+)b": {
+			{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", false},
+			{"aaab", true},
+		},
+		"(?>x(y))\\1|z": {
+			{"xyy", true},
+			{"z", true},
+		},
+		"\\p{L}[\\p{L}\\p{Nd}_]*": {
+			{"değişken_2", true},
+			{"переменная", true},
+			{"_x", false},
+			{"x-y", false},
+		},
+		"\\p{Greek}+\\P{Greek}": {
+			{"αβγx", true},
+			{"αβγδ", false},
+		},
+		"[^\\pL\\s]+": {
+			{"123!", true},
+			{"12a", false},
+		},
+		"\\p{Han}\\p{Hiragana}\\p{Lu}": {
+			{"日のA", true},
+			{"日のa", false},
+		},
 		"a*a*a*a*b": {
 			{"aaaaaaaaaaaaaa", false},
 		},
@@ -289,6 +643,48 @@ func TestBacktrackingRegexMatchPartial(t *testing.T) {
 			{"baa", true},
 			{"", false},
 		},
+		"^foo": {
+			{"foo bar", true},
+			{"a foo", false},
+		},
+		"bar$": {
+			{"foo bar", true},
+			{"bar foo", false},
+		},
+		"\\Afoo\\z": {
+			{"foo", true},
+			{"foo ", false},
+		},
+		"\\bcat\\b": {
+			{"a cat sat", true},
+			{"cat", true},
+			{"concat", false},
+			{"cats", false},
+			{"(cat)", true},
+		},
+		"\\Bcat": {
+			{"concat", true},
+			{"a cat", false},
+		},
+		"(?m)^owner$": {
+			{"name\nowner\nvalue", true},
+			{"name\nowner value", false},
+		},
+		"(?m)\\Aowner": {
+			{"name\nowner", false},
+		},
+		"^$": {
+			{"", true},
+			{"x", false},
+		},
+		"çok\\b": {
+			{"ne çok güzel", true},
+			{"çoklu", false},
+		},
+		"ü.$": {
+			{"grüße über", false},
+			{"zürich üx", true},
+		},
 	}
 
 	for key, val := range cases {
@@ -302,3 +698,128 @@ func TestBacktrackingRegexMatchPartial(t *testing.T) {
 		}
 	}
 }
+
+func TestBacktrackingRegexMatchBasicSyntax(t *testing.T) {
+	cases := map[string][]struct {
+		input string
+		match bool
+	}{
+		"a\\(bc\\)*d": {
+			{"ad", true},
+			{"abcbcd", true},
+			{"abd", false},
+		},
+		"x\\{2,3\\}": {
+			{"xx", true},
+			{"xxx", true},
+			{"xxxx", false},
+		},
+		"*a+": {
+			{"*a+", true},
+			{"aa", false},
+		},
+		"a|b": {
+			{"a|b", true},
+			{"a", false},
+		},
+		"^a^b$c$": {
+			{"a^b$c", true},
+			{"abc", false},
+		},
+		"[]x]*": {
+			{"]x]", true},
+			{"]y", false},
+		},
+		"[\\.]\\.": {
+			{"\\.", true},
+			{"..", true},
+			{"x.", false},
+		},
+		"\\(ab*\\)c\\1": {
+			{"abbcabb", true},
+			{"abbcab", false},
+		},
+	}
+
+	for key, val := range cases {
+		ast, err := ParseWithFlags(key, BRE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range val {
+			if got := MatchBacktrack(ast, c.input); got != c.match {
+				t.Errorf("Pattern = %s, Match(%q) = %v, want %v", key, c.input, got, c.match)
+			}
+		}
+	}
+}
+
+func TestBacktrackingRegexMatchFoldCase(t *testing.T) {
+	cases := map[string][]struct {
+		input string
+		match bool
+	}{
+		"straße": {
+			{"STRASSE", false},
+			{"STRAẞE", true},
+		},
+		"[a-f]+x": {
+			{"CafeX", true},
+			{"cagex", false},
+		},
+		"a(?-i)b": {
+			{"Ab", true},
+			{"AB", false},
+		},
+		"(?i)[[:upper:]]": {
+			{"a", true},
+			{"1", false},
+		},
+		"(?i)\\p{Lu}": {
+			{"a", true},
+			{"ǆ", true},
+		},
+		"(?i)\\P{Lu}": {
+			{"a", false},
+			{"1", true},
+		},
+		"(?i)[^[:lower:]]": {
+			{"A", false},
+			{"1", true},
+		},
+	}
+
+	for key, val := range cases {
+		ast, err := ParseWithFlags(key, FoldCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range val {
+			if got := MatchBacktrack(ast, c.input); got != c.match {
+				t.Errorf("Pattern = %s, Match(%q) = %v, want %v", key, c.input, got, c.match)
+			}
+		}
+	}
+}
+
+func TestFindBacktrackSubmatchAtomic(t *testing.T) {
+	cases := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{"(?>(a))b|ac", "ac", []int{0, 2, -1, -1}},
+		{"(?>(x)+)y|(x)z", "xxz", []int{1, 3, -1, -1, 1, 2}},
+		{"(a)*+", "aa", []int{0, 2, 1, 2}},
+	}
+
+	for _, c := range cases {
+		ast, err := Parse(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FindBacktrackSubmatch(ast, c.input); !slices.Equal(got, c.want) {
+			t.Errorf("Pattern = %s, FindBacktrackSubmatch(%q) = %v, want %v", c.pattern, c.input, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestFindSubmatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{"a(b)c", "xabc", []int{1, 4, 2, 3}},
+		{"(a)(b)?", "a", []int{0, 1, 0, 1, -1, -1}},
+		{"(a*)(a*)", "aaa", []int{0, 3, 0, 3, 3, 3}},
+		{"(a|ab)(c|bcd)", "abcd", []int{0, 4, 0, 1, 1, 4}},
+		{"(a+)+b", "aab", []int{0, 3, 0, 2}},
+		{"(\\w+)@(\\w+)\\.com", "mail bob@example.com now", []int{5, 20, 5, 8, 9, 16}},
+		{"((a)|b)+", "ab", []int{0, 2, 1, 2, 0, 1}},
+		{"(?:x(y))z", "xyz", []int{0, 3, 1, 2}},
+		{"(?i:(k))", "K", []int{0, 1, 0, 1}},
+		{"(é+)(.)", "ééx", []int{0, 5, 0, 4, 4, 5}},
+		{"(a){2}", "aaa", []int{0, 2, 1, 2}},
+		{"\\b(cat)\\b", "concat cat", []int{7, 10, 7, 10}},
+		{"()", "x", []int{0, 0, 0, 0}},
+		{"(q)", "abc", nil},
+		{"<(.*?)>", "<a><b>", []int{0, 3, 1, 2}},
+		{"<(.*)>", "<a><b>", []int{0, 6, 1, 5}},
+		{"(a+?)(a*)", "aaa", []int{0, 3, 0, 1, 1, 3}},
+		{"(a??)(a)", "aa", []int{0, 1, 0, 0, 0, 1}},
+		{"(a{1,3}?)(a*)", "aaaa", []int{0, 4, 0, 1, 1, 4}},
+		{"((ab)+?)(.*)", "ababx", []int{0, 5, 0, 2, 0, 2, 2, 5}},
+		{"x(.*?)y", "xaybyx", []int{0, 3, 1, 2}},
+		{"(\\w+?)(\\d*)$", "abc12", []int{0, 5, 0, 3, 3, 5}},
+		{"(a*)?", "b", []int{0, 0, 0, 0}},
+		{"x(|a)*", "xa", []int{0, 1, 1, 1}},
+		{"(|a)+", "a", []int{0, 0, 0, 0}},
+		{"(a*){2,}", "aa", []int{0, 2, 2, 2}},
+		{"(a){0}b", "b", []int{0, 1, -1, -1}},
+	}
+
+	for _, c := range cases {
+		ast, err := Parse(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := FindSubmatch(nfa, c.input)
+		if !slices.Equal(got, c.want) {
+			t.Errorf("Pattern = %s, FindSubmatch(%q) = %v, want %v", c.pattern, c.input, got, c.want)
+		}
+		if backtrack := FindBacktrackSubmatch(ast, c.input); !slices.Equal(got, backtrack) {
+			t.Errorf("Pattern = %s, FindSubmatch(%q) = %v, FindBacktrackSubmatch = %v", c.pattern, c.input, got, backtrack)
+		}
+	}
+}
+
+func TestFindNamed(t *testing.T) {
+	pattern := `owner (?P<owner>\w+);[^c]*count (?<count>\d+)|(?P<missing>x)`
+	cases := []struct {
+		input string
+		want  map[string]string
+	}{
+		{"owner person1; count 1234", map[string]string{"owner": "person1", "count": "1234"}},
+		{"value 1\n owner unknown;\n }\n count 5;", map[string]string{"owner": "unknown", "count": "5"}},
+		{"x", map[string]string{"missing": "x"}},
+		{"owner", nil},
+	}
+
+	ast, err := Parse(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := nfa.SubexpNames(); !slices.Equal(names, []string{"", "owner", "count", "missing"}) {
+		t.Errorf("SubexpNames() = %q", names)
+	}
+	for _, c := range cases {
+		if got := FindNamed(nfa, c.input); !maps.Equal(got, c.want) {
+			t.Errorf("FindNamed(%q) = %v, want %v", c.input, got, c.want)
+		}
+		if got := FindBacktrackNamed(ast, c.input); !maps.Equal(got, c.want) {
+			t.Errorf("FindBacktrackNamed(%q) = %v, want %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestFindNamedConfig(t *testing.T) {
+	ast, err := Parse(`subtype (?P<subtype>\w+) \{\s+element TestElement4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"subtype": "TestSubType3"}
+	if got := FindNamed(nfa, allConfig); !maps.Equal(got, want) {
+		t.Errorf("FindNamed(allConfig) = %v, want %v", got, want)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -161,7 +164,10 @@ func TestRegexPerformance(t *testing.T) {
 	l := New(pattern)
 	parser := NewParser(l)
 	ast := parser.Ast()
-	nfa := Compile(ast)
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 	str := nfa.ToDigraph()
 	fmt.Println(str)
 	if got := Match(nfa, config); got != true {
@@ -174,7 +180,10 @@ func TestRegexPerformancePartial(t *testing.T) {
 	l := New(pattern)
 	parser := NewParser(l)
 	ast := parser.Ast()
-	nfa := Compile(ast)
+	nfa, err := Compile(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
 	str := nfa.ToDigraph()
 	fmt.Println(str)
 	if got := MatchPartial(nfa, allConfig); got != true {
@@ -394,6 +403,278 @@ func TestRegexMatch(t *testing.T) {
 			{"aaaab", true},
 			{"aaaaaaab", true},
 		},
+		"foo|bar": {
+			{"foo", true},
+			{"bar", true},
+			{"fo", false},
+			{"foobar", false},
+			{"", false},
+		},
+		"a(b|c)d": {
+			{"abd", true},
+			{"acd", true},
+			{"ad", false},
+			{"abcd", false},
+		},
+		"(ab)*c": {
+			{"c", true},
+			{"abc", true},
+			{"ababc", true},
+			{"abac", false},
+			{"ab", false},
+		},
+		"(a|ab)(c|bcd)": {
+			{"ac", true},
+			{"abcd", true},
+			{"abc", true},
+			{"abd", false},
+		},
+		"(a|ab)*c": {
+			{"abc", true},
+			{"aabac", true},
+			{"abbc", false},
+		},
+		"a(|b)c": {
+			{"ac", true},
+			{"abc", true},
+			{"abbc", false},
+		},
+		"ab+c": {
+			{"abc", true},
+			{"abbbc", true},
+			{"ac", false},
+			{"abbb", false},
+		},
+		"colou?r": {
+			{"color", true},
+			{"colour", true},
+			{"colouur", false},
+		},
+		"a{3}": {
+			{"aaa", true},
+			{"aa", false},
+			{"aaaa", false},
+		},
+		"a{2,}b": {
+			{"aab", true},
+			{"aaaaab", true},
+			{"ab", false},
+		},
+		"a{2,4}": {
+			{"a", false},
+			{"aa", true},
+			{"aaa", true},
+			{"aaaa", true},
+			{"aaaaa", false},
+		},
+		"(ab|c){2,3}d": {
+			{"abcd", true},
+			{"ccd", true},
+			{"ababcd", true},
+			{"cd", false},
+			{"ababccd", false},
+		},
+		"a{0}b": {
+			{"b", true},
+			{"ab", false},
+		},
+		"(a|)+b": {
+			{"b", true},
+			{"aab", true},
+		},
+		"a{,2}": {
+			{"a{,2}", true},
+			{"aa", false},
+		},
+		"[a-c]x": {
+			{"ax", true},
+			{"bx", true},
+			{"cx", true},
+			{"dx", false},
+			{"-x", false},
+		},
+		"[^a-c]x": {
+			{"dx", true},
+			{" x", true},
+			{"ax", false},
+			{"cx", false},
+			{"x", false},
+		},
+		"[^\\s]+": {
+			{"abc", true},
+			{"a c", false},
+		},
+		"[a-zA-Z_][a-zA-Z0-9_]*": {
+			{"x", true},
+			{"_Foo1", true},
+			{"1abc", false},
+			{"ab-c", false},
+		},
+		"[a-]+": {
+			{"a-a", true},
+			{"b", false},
+		},
+		"^ab$": {
+			{"ab", true},
+			{"abc", false},
+		},
+		"a\\bb": {
+			{"ab", false},
+		},
+		"\\bfoo\\b": {
+			{"foo", true},
+			{"foobar", false},
+		},
+		"a$b": {
+			{"ab", false},
+		},
+		"\\d+\\.\\d+": {
+			{"3.14", true},
+			{"3x14", false},
+			{"3.", false},
+		},
+		"\\w+\\W\\w+": {
+			{"foo_1 bar", true},
+			{"foo_1bar", false},
+		},
+		"\\D\\t\\x41": {
+			{"x\tA", true},
+			{"1\tA", false},
+		},
+		"a\\*b\\\\": {
+			{"a*b\\", true},
+			{"aab\\", false},
+		},
+		"\\[\\d{2}\\]": {
+			{"[42]", true},
+			{"42", false},
+		},
+		"[\\s\\S]\\S": {
+			{"\nx", true},
+			{"x ", false},
+			{"x\u00a0", false},
+		},
+		"héllo": {
+			{"héllo", true},
+			{"hello", false},
+			{"hélló", false},
+		},
+		"[α-ω]+": {
+			{"αβγ", true},
+			{"ω", true},
+			{"αbγ", false},
+			{"Ω", false},
+		},
+		"日本.語": {
+			{"日本の語", true},
+			{"日本語", false},
+		},
+		"[^é]x": {
+			{"ex", true},
+			{"éx", false},
+			{"ñx", true},
+		},
+		"\\w\\W\\S": {
+			{"a€ü", true},
+			{"é€ü", false},
+		},
+		"😀+\\s?": {
+			{"😀😀 ", true},
+			{"😀😀😀", true},
+			{"😃", false},
+		},
+		"[[:alpha:]_][[:alnum:]]*": {
+			{"_x9", true},
+			{"a", true},
+			{"9a", false},
+			{"é", false},
+		},
+		"[^[:digit:][:space:]]+": {
+			{"ab-c", true},
+			{"a b", false},
+			{"a1", false},
+		},
+		"[[:upper:][:punct:]][[:xdigit:]]": {
+			{"Af", true},
+			{"!0", true},
+			{"ag", false},
+			{"Ag", false},
+		},
+		"[[:blank:]][[:cntrl:]][[:graph:]][[:print:]][[:lower:]]": {
+			{"\t\n~ a", true},
+			{" \x7f!!z", true},
+			{"  ~ a", false},
+			{"\t\n \na", false},
+		},
+		"(?i)parent": {
+			{"Parent", true},
+			{"PARENT", true},
+			{"parents", false},
+		},
+		"a(?i)b|c": {
+			{"aB", true},
+			{"C", true},
+			{"AB", false},
+		},
+		"(?i:k)(?-i)k[a-c]": {
+			{"\u212akb", true},
+			{"KkC", false},
+			{"KKb", false},
+		},
+		"x(?i:[α-γ]+)x": {
+			{"xΑβΓx", true},
+			{"xΔx", false},
+			{"XαX", false},
+		},
+		"(?i)[^k]ß": {
+			{"aẞ", true},
+			{"\u212aß", false},
+		},
+		"a.b": {
+			{"a b", true},
+			{"a\nb", false},
+		},
+		"(?s)a.b": {
+			{"a\nb", true},
+			{"a\rb", true},
+		},
+		"(?s:a.)b.": {
+			{"a\nbc", true},
+			{"a\nb\n", false},
+		},
+		"a\n^b": {
+			{"a\nb", false},
+		},
+		"(?m)a$\n^b$": {
+			{"a\nb", true},
+			{"ab", false},
+		},
+		"\\p{L}[\\p{L}\\p{Nd}_]*": {
+			{"değişken_2", true},
+			{"переменная", true},
+			{"_x", false},
+			{"x-y", false},
+		},
+		"\\p{Greek}+\\P{Greek}": {
+			{"αβγx", true},
+			{"αβγδ", false},
+		},
+		"[^\\pL\\s]+": {
+			{"123!", true},
+			{"12a", false},
+		},
+		"\\p{Han}\\p{Hiragana}\\p{Lu}": {
+			{"日のA", true},
+			{"日のa", false},
+		},
+		"\\Q1+1\\E=2": {
+			{"1+1=2", true},
+			{"11=2", false},
+		},
+		"x\\Q(*)\\E+": {
+			{"x(*)))", true},
+			{"x(*)(*)", false},
+		},
 		/*
 		"a*a*a*a*X": {
 			{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaY",false},
@@ -405,7 +686,10 @@ func TestRegexMatch(t *testing.T) {
 		l := New(key)
 		parser := NewParser(l)
 		ast := parser.Ast()
-		nfa := Compile(ast)
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
 		for _, c := range val {
 			if got := Match(nfa, c.input); got != c.match {
 				t.Errorf("Pattern = %s, Match(%q) = %v, want %v", key, c.input, got, c.match)
@@ -434,13 +718,58 @@ func TestRegexMatchPartial(t *testing.T) {
 			{"baa", true},              
 			{"", false},                
 		},
+		"^foo": {
+			{"foo bar", true},
+			{"a foo", false},
+		},
+		"bar$": {
+			{"foo bar", true},
+			{"bar foo", false},
+		},
+		"\\Afoo\\z": {
+			{"foo", true},
+			{"foo ", false},
+		},
+		"\\bcat\\b": {
+			{"a cat sat", true},
+			{"cat", true},
+			{"concat", false},
+			{"cats", false},
+			{"(cat)", true},
+		},
+		"\\Bcat": {
+			{"concat", true},
+			{"a cat", false},
+		},
+		"^$": {
+			{"", true},
+			{"x", false},
+		},
+		"(?m)^owner$": {
+			{"name\nowner\nvalue", true},
+			{"name\nowner value", false},
+		},
+		"(?m)\\Aowner": {
+			{"name\nowner", false},
+		},
+		"çok\\b": {
+			{"ne çok güzel", true},
+			{"çoklu", false},
+		},
+		"ü.$": {
+			{"grüße über", false},
+			{"zürich üx", true},
+		},
 	}
 
 	for key, val := range cases {
 		l := New(key)
 		parser := NewParser(l)
 		ast := parser.Ast()
-		nfa := Compile(ast)
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
 		for _, c := range val {
 			if got := MatchPartial(nfa, c.input); got != c.match {
 				t.Errorf("Pattern = %s, Match(%q) = %v, want %v", key, c.input, got, c.match)
@@ -448,3 +777,263 @@ func TestRegexMatchPartial(t *testing.T) {
 		}
 	}
 }
+
+func TestRegexMatchBasicSyntax(t *testing.T) {
+	cases := map[string][]struct {
+		input string
+		match bool
+	}{
+		"a\\(bc\\)*d": {
+			{"ad", true},
+			{"abcbcd", true},
+			{"abd", false},
+		},
+		"x\\{2,3\\}": {
+			{"xx", true},
+			{"xxx", true},
+			{"xxxx", false},
+		},
+		"*a+": {
+			{"*a+", true},
+			{"aa", false},
+		},
+		"a|b": {
+			{"a|b", true},
+			{"a", false},
+		},
+		"^a^b$c$": {
+			{"a^b$c", true},
+			{"abc", false},
+		},
+		"[]x]*": {
+			{"]x]", true},
+			{"]y", false},
+		},
+		"[\\.]\\.": {
+			{"\\.", true},
+			{"..", true},
+			{"x.", false},
+		},
+	}
+
+	for key, val := range cases {
+		ast, err := ParseWithFlags(key, BRE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range val {
+			if got := Match(nfa, c.input); got != c.match {
+				t.Errorf("Pattern = %s, Match(%q) = %v, want %v", key, c.input, got, c.match)
+			}
+		}
+	}
+}
+
+// TestFindLongestExtendedSyntax checks that ERE patterns match as they do in
+// egrep, where Perl constructs are plain characters.
+func TestFindLongestExtendedSyntax(t *testing.T) {
+	cases := []struct {
+		pattern string
+		input   string
+		want    []int
+	}{
+		{"*a", "a*a", []int{1, 3}},
+		{"x|+y", "a+y", []int{1, 3}},
+		{"a+?b", "xaab", []int{1, 4}},
+		{"a+?b", "b", []int{0, 1}},
+		{"a++b", "xaab", []int{1, 4}},
+		{"a*?", "aaa", []int{0, 3}},
+		{"(?i)A", "a?iA", []int{1, 4}},
+		{"(?i)A", "a", nil},
+		{"\\d+", "12dd", []int{2, 4}},
+		{"\\w\\b", "wb", []int{0, 2}},
+	}
+
+	for _, c := range cases {
+		ast, err := ParseWithFlags(c.pattern, ERE)
+		if err != nil {
+			t.Fatalf("ParseWithFlags(%q, ERE) failed: %v", c.pattern, err)
+		}
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %v", c.pattern, err)
+		}
+		if got := FindLongest(nfa, c.input); !slices.Equal(got, c.want) {
+			t.Errorf("Pattern = %s, FindLongest(%q) = %v, want %v", c.pattern, c.input, got, c.want)
+		}
+	}
+}
+
+func TestFindLongestVersusBacktrack(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		input    string
+		longest  []int
+		leftmost []int
+	}{
+		{"a|ab", "ab", []int{0, 2}, []int{0, 1}},
+		{"(a|ab)(c|bcd)", "abcd", []int{0, 4}, []int{0, 4}},
+		{"(a|ab)c?", "abc", []int{0, 3}, []int{0, 1}},
+		{"x*|y+", "yyy", []int{0, 3}, []int{0, 0}},
+		{"b+|a+b*", "xaabbb", []int{1, 6}, []int{1, 6}},
+		{"[]a]+", "b]a]b", []int{1, 4}, []int{1, 4}},
+		{"if|iffy|i", "iffy stuff", []int{0, 4}, []int{0, 2}},
+		{"q", "abc", nil, nil},
+	}
+
+	for _, c := range cases {
+		ast, err := ParseWithFlags(c.pattern, ERE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := FindLongest(nfa, c.input); !slices.Equal(got, c.longest) {
+			t.Errorf("Pattern = %s, FindLongest(%q) = %v, want %v", c.pattern, c.input, got, c.longest)
+		}
+		if got := FindBacktrack(ast, c.input); !slices.Equal(got, c.leftmost) {
+			t.Errorf("Pattern = %s, FindBacktrack(%q) = %v, want %v", c.pattern, c.input, got, c.leftmost)
+		}
+	}
+}
+
+func TestRegexMatchFoldCase(t *testing.T) {
+	cases := map[string][]struct {
+		input string
+		match bool
+	}{
+		"straße": {
+			{"STRASSE", false},
+			{"STRAẞE", true},
+		},
+		"[a-f]+x": {
+			{"CafeX", true},
+			{"cagex", false},
+		},
+		"a(?-i)b": {
+			{"Ab", true},
+			{"AB", false},
+		},
+		"(?i)[[:upper:]]": {
+			{"a", true},
+			{"1", false},
+		},
+		"(?i)\\p{Lu}": {
+			{"a", true},
+			{"ǆ", true},
+		},
+		"(?i)\\P{Lu}": {
+			{"a", false},
+			{"1", true},
+		},
+		"(?i)[^[:lower:]]": {
+			{"A", false},
+			{"1", true},
+		},
+	}
+
+	for key, val := range cases {
+		ast, err := ParseWithFlags(key, FoldCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range val {
+			if got := Match(nfa, c.input); got != c.match {
+				t.Errorf("Pattern = %s, Match(%q) = %v, want %v", key, c.input, got, c.match)
+			}
+		}
+	}
+}
+
+func TestRegexMatchConfigLines(t *testing.T) {
+	cases := []struct {
+		pattern string
+		input   string
+		match   bool
+	}{
+		{`parent.*owner person1`, config, false},
+		{`(?s)parent.*owner person1`, config, true},
+		{`(?m)^ *owner person2;$`, allConfig, true},
+		{`^ *owner person2;$`, allConfig, false},
+		{`(?m)^ *count 4$`, allConfig, false},
+		{`(?mx)
+			^ \  *        # indentation
+			owner \  person2 ;
+			$`, allConfig, true},
+	}
+
+	for _, c := range cases {
+		ast, err := Parse(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nfa, err := Compile(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := MatchPartial(nfa, c.input); got != c.match {
+			t.Errorf("Pattern = %s, MatchPartial() = %v, want %v", c.pattern, got, c.match)
+		}
+	}
+}
+
+func TestCompileBacktrackOnly(t *testing.T) {
+	for _, pattern := range []string{"a(?=b)", "a(?!b)", "(?<=a)b", "(?<!a)b", "(?>a)b", "a*+", "(a|b){2}+"} {
+		ast, err := Parse(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Compile(ast); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Compile(%q) error = %v, want %v", pattern, err, ErrNotSupported)
+		}
+	}
+}
+
+func TestCompileNotSupportedMessage(t *testing.T) {
+	cases := []struct {
+		pattern string
+		want    string
+	}{
+		{"x(?<=ab*)", "lookaround (?<=ab*): not supported by automata engine"},
+		{"(?!(a|b)+)", "lookaround (?!(a|b)+): not supported by automata engine"},
+		{"(ab)*+", "possessive quantifier (ab)*+: not supported by automata engine"},
+		{"x(?:a|bc){2}+", "possessive quantifier (?:a|bc){2}+: not supported by automata engine"},
+		{"(?>a+b)c", "atomic group (?>a+b): not supported by automata engine"},
+	}
+	for _, c := range cases {
+		ast, err := Parse(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Compile(ast); err == nil || err.Error() != c.want {
+			t.Errorf("Compile(%q) error = %v, want %s", c.pattern, err, c.want)
+		}
+	}
+}
+
+func TestCompileBackreference(t *testing.T) {
+	ast, err := Parse("(a)\\1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Compile(ast)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Compile() error = %v, want %v", err, ErrNotSupported)
+	}
+	if !strings.Contains(err.Error(), "backreference \\1") {
+		t.Errorf("Compile() error = %q, expected it to name the backreference", err)
+	}
+	if !MatchBacktrack(ast, "aa") {
+		t.Errorf("MatchBacktrack(%q) = false, want true", "aa")
+	}
+}
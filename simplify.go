@@ -0,0 +1,225 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+)
+
+// Rule names a rewrite of the simplification pass.
+type Rule int
+
+const (
+	// NestedQuantifier folds a quantified quantifier into one, (?:a*)* into
+	// a* or (?:a+)? into a*. Quantifiers written one after the other, such
+	// as a** or a+?*, nest that way when parsed with StackedQuantifiers.
+	NestedQuantifier Rule = iota
+	// MergedQuantifiers merges adjacent repetitions of the same thing, .*.*
+	// into .* or a*a+ into a+.
+	MergedQuantifiers
+	// DuplicateChars drops the repeated members of a list, [aa] into [a].
+	DuplicateChars
+	// SingleCharList replaces a list of one character by that character, [a]
+	// into a.
+	SingleCharList
+	// PlainGroup removes a group that neither captures nor sets flags, which
+	// only the parser needed.
+	PlainGroup
+)
+
+func (r Rule) String() string {
+	return [...]string{"nested quantifier", "merged quantifiers", "duplicate chars", "single char list", "plain group"}[r]
+}
+
+// Rewrite reports a rewrite that fired, with the subtree it applied to and
+// the one it was replaced by, both printed with Pattern.
+type Rewrite struct {
+	Rule   Rule
+	Before string
+	After  string
+}
+
+// Simplify rewrites node into a smaller tree matching the same strings, and
+// returns it along with the rewrites that fired, innermost first. It is meant
+// to run on a parsed pattern before Compile or MatchBacktrack. Capturing
+// groups are never removed, so group numbers and FindSubmatch results keep
+// their meaning, and neither are possessive quantifiers, which do not match
+// the same strings once merged. Nested sequences are spliced into the ones
+// containing them as well, but as that leaves the printed pattern as it was,
+// it is not reported. node itself is left unchanged.
+func Simplify(node Node) (Node, []Rewrite) {
+	var s simplifier
+	return s.simplify(node), s.rewrites
+}
+
+type simplifier struct {
+	rewrites []Rewrite
+}
+
+func (s *simplifier) report(rule Rule, before, after Node) {
+	s.rewrites = append(s.rewrites, Rewrite{Rule: rule, Before: Pattern(before), After: Pattern(after)})
+}
+
+func (s *simplifier) simplify(node Node) Node {
+	switch n := node.(type) {
+	case *SequenceNode:
+		return s.simplifySequence(n)
+	case *AlternationNode:
+		alternation := &AlternationNode{}
+		for _, alt := range n.Alternatives {
+			alternation.Alternatives = append(alternation.Alternatives, s.simplify(alt))
+		}
+		return alternation
+	case *CharList:
+		return s.simplifyCharList(n)
+	case *StarNode, *PlusNode, *QuestionNode, *RepeatNode:
+		return s.simplifyQuantifier(n)
+	case *GroupNode:
+		child := s.simplify(n.Child)
+		if n.Index == 0 {
+			// flags set inside the group are already part of its nodes
+			s.report(PlainGroup, n, child)
+			return child
+		}
+		return &GroupNode{Child: child, Index: n.Index, Name: n.Name}
+	case *AtomicNode:
+		return &AtomicNode{Child: s.simplify(n.Child)}
+	case *LookaroundNode:
+		return &LookaroundNode{Child: s.simplify(n.Child), Behind: n.Behind, Negated: n.Negated}
+	}
+	return node
+}
+
+func (s *simplifier) simplifySequence(n *SequenceNode) Node {
+	sequence := &SequenceNode{}
+	for _, child := range n.Children {
+		child = s.simplify(child)
+		if nested, ok := child.(*SequenceNode); ok {
+			for _, c := range nested.Children {
+				sequence.Children = s.appendMerged(sequence.Children, c)
+			}
+			continue
+		}
+		sequence.Children = s.appendMerged(sequence.Children, child)
+	}
+	return sequence
+}
+
+// appendMerged appends node to children, merging it into the last child when
+// both repeat the same thing.
+func (s *simplifier) appendMerged(children []Node, node Node) []Node {
+	if len(children) == 0 {
+		return append(children, node)
+	}
+	last := children[len(children)-1]
+	merged := mergeQuantifiers(last, node)
+	if merged == nil {
+		return append(children, node)
+	}
+	s.report(MergedQuantifiers, &SequenceNode{Children: []Node{last, node}}, merged)
+	return append(children[:len(children)-1], merged)
+}
+
+// mergeQuantifiers returns the single quantifier matching what first followed
+// by second do, or nil when there is none. x*x* is x*, while x*x+ and x+x*
+// are both x+.
+func mergeQuantifiers(first, second Node) Node {
+	q1, ok1 := asQuantifier(first)
+	q2, ok2 := asQuantifier(second)
+	if !ok1 || !ok2 || q1.possessive || q2.possessive || q1.lazy != q2.lazy ||
+		q1.max != -1 || q2.max != -1 || !reflect.DeepEqual(q1.child, q2.child) || hasCaptures(q1.child) {
+		return nil
+	}
+	if q1.min == 0 && q2.min == 0 {
+		return &StarNode{Child: q1.child, Lazy: q1.lazy}
+	}
+	if q1.min+q2.min == 1 {
+		return &PlusNode{Child: q1.child, Lazy: q1.lazy}
+	}
+	return nil
+}
+
+// asQuantifier describes node like repetition does when node is a star, a
+// plus or a question mark.
+func asQuantifier(node Node) (repeat, bool) {
+	switch node.(type) {
+	case *StarNode, *PlusNode, *QuestionNode:
+		return repetition(node), true
+	}
+	return repeat{}, false
+}
+
+func (s *simplifier) simplifyQuantifier(node Node) Node {
+	r := repetition(node)
+	child := s.simplify(r.child)
+	if seq, ok := child.(*SequenceNode); ok && len(seq.Children) == 1 {
+		child = seq.Children[0]
+	}
+	inner, ok := asQuantifier(child)
+	outer, isOuter := asQuantifier(node)
+	if ok && isOuter && !inner.possessive && !outer.possessive && (inner.lazy == outer.lazy || lazyInGreedyLoop(inner, outer)) {
+		// both agree when they are the same, otherwise they match any number
+		// of the inner child
+		folded := withChild(node, inner.child)
+		if reflect.TypeOf(node) != reflect.TypeOf(child) {
+			folded = &StarNode{Child: inner.child, Lazy: outer.lazy}
+		}
+		s.report(NestedQuantifier, withChild(node, child), folded)
+		return folded
+	}
+	return withChild(node, child)
+}
+
+// lazyInGreedyLoop reports whether inner is a lazy x+? of a single character
+// repeated by the greedy loop outer, as in a+?*. The loop takes as many of
+// them as it can, so it finds its matches in the order a greedy one would.
+func lazyInGreedyLoop(inner, outer repeat) bool {
+	return inner.lazy && !outer.lazy && inner.min == 1 && inner.max == -1 && outer.max == -1 && isSingleCharacter(inner.child)
+}
+
+// withChild returns a copy of the quantifier node repeating child instead.
+func withChild(node Node, child Node) Node {
+	switch n := node.(type) {
+	case *StarNode:
+		return &StarNode{Child: child, Lazy: n.Lazy, Possessive: n.Possessive}
+	case *PlusNode:
+		return &PlusNode{Child: child, Lazy: n.Lazy, Possessive: n.Possessive}
+	case *QuestionNode:
+		return &QuestionNode{Child: child, Lazy: n.Lazy, Possessive: n.Possessive}
+	case *RepeatNode:
+		return &RepeatNode{Child: child, Min: n.Min, Max: n.Max, Lazy: n.Lazy, Possessive: n.Possessive}
+	}
+	return node
+}
+
+func (s *simplifier) simplifyCharList(n *CharList) Node {
+	list := &CharList{Negated: n.Negated}
+	for _, char := range n.Chars {
+		if !slices.ContainsFunc(list.Chars, func(c CharacterNode) bool { return reflect.DeepEqual(c, char) }) {
+			list.Chars = append(list.Chars, char)
+		}
+	}
+	if len(list.Chars) < len(n.Chars) {
+		s.report(DuplicateChars, n, list)
+	}
+	if list.Negated || len(list.Chars) != 1 {
+		return list
+	}
+	switch c := list.Chars[0].(type) {
+	case *MetaCharacterNode:
+		if _, ok := posixClasses[c.Value]; ok {
+			// named classes only exist inside brackets
+			return list
+		}
+		s.report(SingleCharList, list, c)
+		return c
+	case *LiteralNode:
+		s.report(SingleCharList, list, c)
+		return c
+	}
+	return list
+}
+
+// hasCaptures reports whether node contains a capturing group.
+func hasCaptures(node Node) bool {
+	return len(SubexpNames(node)) > 1
+}
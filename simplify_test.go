@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	cases := []struct {
+		node  Node
+		want  string
+		rules []Rule
+	}{
+		{b.Seq(b.Star(b.Star(b.Lit('a')))), "a*", []Rule{NestedQuantifier}},
+		{b.Seq(b.Question(b.Plus(b.Lit('a')))), "a*", []Rule{NestedQuantifier}},
+		{b.Seq(b.Plus(b.Plus(b.Lit('a')))), "a+", []Rule{NestedQuantifier}},
+		{b.Seq(b.Seq(b.Seq(b.Lit('a')), b.Lit('b'))), "ab", nil},
+		{b.Seq(b.Star(b.Seq(b.Lit('a')))), "a*", nil},
+		{mustParse(t, ".*.*"), ".*", []Rule{MergedQuantifiers}},
+		{mustParse(t, "a*a+b+b*c*?c*?"), "a+b+c*?", []Rule{MergedQuantifiers, MergedQuantifiers, MergedQuantifiers}},
+		{mustParse(t, "[a]"), "a", []Rule{SingleCharList}},
+		{mustParse(t, "[aa]"), "a", []Rule{DuplicateChars, SingleCharList}},
+		{mustParse(t, "[^aa-za-z]"), "[^aa-z]", []Rule{DuplicateChars}},
+		{mustParse(t, "[\\d]"), "\\d", []Rule{SingleCharList}},
+		{mustParse(t, "[[:alpha:]]"), "[[:alpha:]]", nil},
+		{mustParse(t, "[[:digit:][:digit:]]"), "[[:digit:]]", []Rule{DuplicateChars}},
+		{mustParse(t, "(?i)[k]"), "(?i)k", []Rule{SingleCharList}},
+		{mustParse(t, "(?:a+)?"), "a*", []Rule{PlainGroup, NestedQuantifier}},
+		{mustParse(t, "x(?:.*)(?:.*)"), "x.*", []Rule{PlainGroup, PlainGroup, MergedQuantifiers}},
+		{mustParse(t, "(?i:ab)c"), "(?i)ab(?-i)c", []Rule{PlainGroup}},
+		{mustParse(t, "(?:a|b)c"), "(?:a|b)c", []Rule{PlainGroup}},
+		{mustParse(t, "(a*)*(a)*(a)*"), "(a*)*(a)*(a)*", nil},
+		{mustParse(t, "a*+a*(?:b?)?+"), "a*+a*(?:b?)?+", []Rule{PlainGroup}},
+		{mustParse(t, "(?:a*?)*"), "(?:a*?)*", []Rule{PlainGroup}},
+		{mustParseStacked(t, "a**"), "a*", []Rule{NestedQuantifier}},
+		{mustParseStacked(t, "a+?*"), "a*", []Rule{NestedQuantifier}},
+		{mustParseStacked(t, "a+?+"), "a+", []Rule{NestedQuantifier}},
+		{mustParseStacked(t, "a*?*"), "(?:a*?)*", nil},
+		{mustParseStacked(t, "a+?*?"), "a*?", []Rule{NestedQuantifier}},
+		{mustParseStacked(t, "a+*?"), "(?:a+)*?", nil},
+		{mustParseStacked(t, "a?**"), "a*", []Rule{NestedQuantifier, NestedQuantifier}},
+		{mustParseStacked(t, "a?*+"), "(?:a?)*+", nil},
+		{mustParse(t, "(?=[aa])(?>[b])"), "(?=a)(?>b)", []Rule{DuplicateChars, SingleCharList, SingleCharList}},
+	}
+	for _, c := range cases {
+		before := Pattern(c.node)
+		got, rewrites := Simplify(c.node)
+		if Pattern(got) != c.want {
+			t.Errorf("Simplify(%s) = %s, want %s", before, Pattern(got), c.want)
+		}
+		var rules []Rule
+		for _, rewrite := range rewrites {
+			rules = append(rules, rewrite.Rule)
+		}
+		if !slices.Equal(rules, c.rules) {
+			t.Errorf("Simplify(%s) rewrites = %v, want %v", before, rules, c.rules)
+		}
+		if Pattern(c.node) != before {
+			t.Errorf("Simplify(%s) changed its argument into %s", before, Pattern(c.node))
+		}
+	}
+}
+
+func TestSimplifyReport(t *testing.T) {
+	_, rewrites := Simplify(mustParse(t, "[bb]*[bb]*"))
+	want := []Rewrite{
+		{DuplicateChars, "[bb]", "[b]"},
+		{SingleCharList, "[b]", "b"},
+		{DuplicateChars, "[bb]", "[b]"},
+		{SingleCharList, "[b]", "b"},
+		{MergedQuantifiers, "b*b*", "b*"},
+	}
+	if !slices.Equal(rewrites, want) {
+		t.Errorf("Simplify([bb]*[bb]*) rewrites = %v, want %v", rewrites, want)
+	}
+}
+
+// TestSimplifyEquivalence checks that simplified trees match exactly the same
+// strings as the original ones, trying every short string over an alphabet.
+func TestSimplifyEquivalence(t *testing.T) {
+	nodes := []Node{
+		b.Seq(b.Star(b.Star(b.Lit('a')))),
+		b.Seq(b.Star(b.Plus(b.Lit('a'))), b.Lit('b')),
+		b.Seq(b.Plus(b.Question(b.Seq(b.Lit('a'), b.Lit('b'))))),
+		b.Seq(b.Question(b.Question(b.Lit('a'))), b.Seq(b.Seq(b.Lit('b')))),
+		b.Seq(b.Lazy(b.Star(b.Lazy(b.Plus(b.Lit('a'))))), b.Lit('b')),
+		mustParse(t, ".*.*"),
+		mustParse(t, "a*a+b"),
+		mustParse(t, "(?:ab)*(?:ab)+"),
+		mustParse(t, "[aa][^bb]"),
+		mustParse(t, "(?:[a]|b)+"),
+		mustParse(t, "(?:(?:a*)*b?)?"),
+		mustParse(t, "(?i)[A]+[.]"),
+		mustParseStacked(t, "a**b"),
+		mustParseStacked(t, "-a+?*"),
+		mustParseStacked(t, "(?:ab)+?+"),
+		mustParseStacked(t, "[ab]?*?A"),
+	}
+	grammar, err := Grammar()
+	if err != nil {
+		t.Fatalf("Grammar failed: %v", err)
+	}
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 100; i++ {
+		pattern, err := RandomPattern(grammar, r, 8)
+		if err != nil {
+			t.Fatalf("RandomPattern failed: %v", err)
+		}
+		nodes = append(nodes, mustParse(t, pattern))
+	}
+
+	inputs := []string{""}
+	for length := 1; length <= 3; length++ {
+		for _, input := range inputs {
+			if len(input) == length-1 {
+				for _, char := range []string{"a", "b", "-", "A"} {
+					inputs = append(inputs, input+char)
+				}
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		simplified, rewrites := Simplify(node)
+		for _, rewrite := range rewrites {
+			if rewrite.Before == rewrite.After {
+				t.Errorf("Simplify(%s) reported %v without changing %s", Pattern(node), rewrite.Rule, rewrite.Before)
+			}
+		}
+		original, err := Compile(node)
+		if err != nil {
+			// only the backtracker can match it
+			for _, input := range inputs {
+				if MatchBacktrack(node, input) != MatchBacktrack(simplified, input) {
+					t.Errorf("%s and its simplification %s disagree on %q", Pattern(node), Pattern(simplified), input)
+				}
+			}
+			continue
+		}
+		nfa, err := Compile(simplified)
+		if err != nil {
+			t.Fatalf("Compile(%s) failed: %v", Pattern(simplified), err)
+		}
+		for _, input := range inputs {
+			if Match(original, input) != Match(nfa, input) {
+				t.Errorf("%s and its simplification %s disagree on %q", Pattern(node), Pattern(simplified), input)
+			}
+		}
+	}
+}
+
+func mustParseStacked(t *testing.T, pattern string) Node {
+	t.Helper()
+	ast, err := ParseWithFlags(pattern, StackedQuantifiers)
+	if err != nil {
+		t.Fatalf("ParseWithFlags(%q, StackedQuantifiers) failed: %v", pattern, err)
+	}
+	return ast
+}
+
+func mustParse(t *testing.T, pattern string) Node {
+	t.Helper()
+	ast, err := Parse(pattern)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", pattern, err)
+	}
+	return ast
+}